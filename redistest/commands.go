@@ -0,0 +1,1138 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redistest
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// version is the Redis version reported by HELLO.
+const version = "7.0.0"
+
+const (
+	errWrongType  = "WRONGTYPE Operation against a key holding the wrong kind of value"
+	errNotInteger = "ERR value is not an integer or out of range"
+	errSyntax     = "ERR syntax error"
+	errNotFloat   = "ERR value is not a valid float"
+)
+
+// command is a command implemented by the server.
+type command struct {
+	// arity is the minimum number of arguments, including the command name.
+	arity int
+	// pubSub reports whether the command is allowed in the Pub/Sub mode.
+	pubSub bool
+	fn     func(c *conn, args []string)
+}
+
+// commands are the commands implemented by the server, by lower case name.
+var commands map[string]command
+
+// transactionCommands are run immediately between MULTI and EXEC instead of
+// being queued.
+var transactionCommands = map[string]bool{
+	"multi":   true,
+	"exec":    true,
+	"discard": true,
+	"quit":    true,
+}
+
+func init() {
+	// commands is initialized here as some commands, such as EXEC, run others.
+	commands = map[string]command{
+		// connection
+		"auth":   {2, false, (*conn).cmdAuth},
+		"client": {2, false, (*conn).cmdClient},
+		"echo":   {2, false, (*conn).cmdEcho},
+		"hello":  {1, false, (*conn).cmdHello},
+		"ping":   {1, true, (*conn).cmdPing},
+		"quit":   {1, true, (*conn).cmdQuit},
+		"select": {2, false, (*conn).cmdSelect},
+		// server
+		"dbsize":   {1, false, (*conn).cmdDBSize},
+		"flushall": {1, false, (*conn).cmdFlushAll},
+		"flushdb":  {1, false, (*conn).cmdFlushDB},
+		"wait":     {3, false, (*conn).cmdWait},
+		// keys
+		"del":     {2, false, (*conn).cmdDel},
+		"exists":  {2, false, (*conn).cmdExists},
+		"expire":  {3, false, (*conn).cmdExpire},
+		"keys":    {2, false, (*conn).cmdKeys},
+		"persist": {2, false, (*conn).cmdPersist},
+		"pexpire": {3, false, (*conn).cmdPExpire},
+		"pttl":    {2, false, (*conn).cmdPTTL},
+		"scan":    {2, false, (*conn).cmdScan},
+		"ttl":     {2, false, (*conn).cmdTTL},
+		"type":    {2, false, (*conn).cmdType},
+		"unlink":  {2, false, (*conn).cmdDel},
+		// strings
+		"append": {3, false, (*conn).cmdAppend},
+		"decr":   {2, false, (*conn).cmdDecr},
+		"decrby": {3, false, (*conn).cmdDecrBy},
+		"get":    {2, false, (*conn).cmdGet},
+		"incr":   {2, false, (*conn).cmdIncr},
+		"incrby": {3, false, (*conn).cmdIncrBy},
+		"mget":   {2, false, (*conn).cmdMGet},
+		"mset":   {3, false, (*conn).cmdMSet},
+		"set":    {3, false, (*conn).cmdSet},
+		"strlen": {2, false, (*conn).cmdStrlen},
+		// hashes
+		"hdel":    {3, false, (*conn).cmdHDel},
+		"hexists": {3, false, (*conn).cmdHExists},
+		"hget":    {3, false, (*conn).cmdHGet},
+		"hgetall": {2, false, (*conn).cmdHGetAll},
+		"hincrby": {4, false, (*conn).cmdHIncrBy},
+		"hkeys":   {2, false, (*conn).cmdHKeys},
+		"hlen":    {2, false, (*conn).cmdHLen},
+		"hmget":   {3, false, (*conn).cmdHMGet},
+		"hmset":   {4, false, (*conn).cmdHMSet},
+		"hscan":   {3, false, (*conn).cmdHScan},
+		"hset":    {4, false, (*conn).cmdHSet},
+		"hvals":   {2, false, (*conn).cmdHVals},
+		// lists
+		"blpop":  {3, false, (*conn).cmdBLPop},
+		"brpop":  {3, false, (*conn).cmdBRPop},
+		"lindex": {3, false, (*conn).cmdLIndex},
+		"llen":   {2, false, (*conn).cmdLLen},
+		"lpop":   {2, false, (*conn).cmdLPop},
+		"lpush":  {3, false, (*conn).cmdLPush},
+		"lrange": {4, false, (*conn).cmdLRange},
+		"rpop":   {2, false, (*conn).cmdRPop},
+		"rpush":  {3, false, (*conn).cmdRPush},
+		// sets
+		"sadd":      {3, false, (*conn).cmdSAdd},
+		"scard":     {2, false, (*conn).cmdSCard},
+		"sismember": {3, false, (*conn).cmdSIsMember},
+		"smembers":  {2, false, (*conn).cmdSMembers},
+		"srem":      {3, false, (*conn).cmdSRem},
+		"sscan":     {3, false, (*conn).cmdSScan},
+		// sorted sets
+		"zadd":   {4, false, (*conn).cmdZAdd},
+		"zcard":  {2, false, (*conn).cmdZCard},
+		"zrem":   {3, false, (*conn).cmdZRem},
+		"zscan":  {3, false, (*conn).cmdZScan},
+		"zscore": {3, false, (*conn).cmdZScore},
+		// streams
+		"xadd":   {5, false, (*conn).cmdXAdd},
+		"xlen":   {2, false, (*conn).cmdXLen},
+		"xrange": {4, false, (*conn).cmdXRange},
+		"xread":  {4, false, (*conn).cmdXRead},
+		// pub/sub
+		"psubscribe":   {2, true, (*conn).cmdPSubscribe},
+		"publish":      {3, false, (*conn).cmdPublish},
+		"punsubscribe": {1, true, (*conn).cmdPUnsubscribe},
+		"subscribe":    {2, true, (*conn).cmdSubscribe},
+		"unsubscribe":  {1, true, (*conn).cmdUnsubscribe},
+		// transactions
+		"discard": {1, false, (*conn).cmdDiscard},
+		"exec":    {1, false, (*conn).cmdExec},
+		"multi":   {1, false, (*conn).cmdMulti},
+		// scripting
+		"eval":    {3, false, (*conn).cmdEval},
+		"evalsha": {3, false, (*conn).cmdEvalSha},
+		"script":  {2, false, (*conn).cmdScript},
+	}
+}
+
+// Kinds of values, as reported by TYPE.
+const (
+	kindString = "string"
+	kindHash   = "hash"
+	kindList   = "list"
+	kindSet    = "set"
+	kindZSet   = "zset"
+	kindStream = "stream"
+)
+
+func kindOf(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return kindString
+	case map[string]string:
+		return kindHash
+	case []string:
+		return kindList
+	case set:
+		return kindSet
+	case zset:
+		return kindZSet
+	case *stream:
+		return kindStream
+	}
+	return "none"
+}
+
+// keys returns the keys of the selected database.
+func (c *conn) keys() map[string]*item {
+	db, ok := c.s.dbs[c.db]
+	if !ok {
+		db = make(map[string]*item)
+		c.s.dbs[c.db] = db
+	}
+	return db
+}
+
+// lookup returns the item stored under key, or nil if the key does not exist
+// or expired.
+func (c *conn) lookup(key string) *item {
+	keys := c.keys()
+	it, ok := keys[key]
+	if !ok {
+		return nil
+	}
+	if !it.expireAt.IsZero() && !time.Now().Before(it.expireAt) {
+		delete(keys, key)
+		return nil
+	}
+	return it
+}
+
+// lookupKind returns the item stored under key, or nil if the key does not
+// exist. If the key holds another kind of value, it writes a WRONGTYPE error
+// and returns false.
+func (c *conn) lookupKind(key, kind string) (*item, bool) {
+	it := c.lookup(key)
+	if it != nil && kindOf(it.value) != kind {
+		c.w.err(errWrongType)
+		return nil, false
+	}
+	return it, true
+}
+
+func parseInt(s string) (int64, bool) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n, err == nil
+}
+
+// validName reports whether name can be used as a connection name.
+func validName(name string) bool {
+	for _, r := range name {
+		if r <= ' ' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *conn) cmdAuth(args []string) {
+	// any credentials are accepted
+	c.w.ok()
+}
+
+func (c *conn) cmdClient(args []string) {
+	switch sub := strings.ToLower(args[0]); {
+	case sub == "setname" && len(args) == 2:
+		if !validName(args[1]) {
+			c.w.err("ERR Client names cannot contain spaces, newlines or special characters.")
+			return
+		}
+		c.name = args[1]
+		c.w.ok()
+	case sub == "getname" && len(args) == 1:
+		if c.name == "" {
+			c.w.null()
+			return
+		}
+		c.w.bulk(c.name)
+	case sub == "id" && len(args) == 1:
+		c.w.int(c.id)
+	case sub == "list" && len(args) == 1:
+		conns := make([]*conn, 0, len(c.s.conns))
+		for other := range c.s.conns {
+			conns = append(conns, other)
+		}
+		sort.Slice(conns, func(i, j int) bool { return conns[i].id < conns[j].id })
+		var b strings.Builder
+		for _, other := range conns {
+			b.WriteString(other.info())
+			b.WriteString("\n")
+		}
+		c.w.bulk(b.String())
+	case sub == "info" && len(args) == 1:
+		c.w.bulk(c.info() + "\n")
+	default:
+		c.w.err("ERR unknown subcommand or wrong number of arguments for '" + args[0] + "'. Try CLIENT HELP.")
+	}
+}
+
+// info describes the connection like CLIENT LIST.
+func (c *conn) info() string {
+	multi := -1
+	if c.multi {
+		multi = len(c.queued)
+	}
+	return "id=" + strconv.FormatInt(c.id, 10) +
+		" addr=" + c.nc.RemoteAddr().String() +
+		" laddr=" + c.nc.LocalAddr().String() +
+		" name=" + c.name +
+		" db=" + strconv.Itoa(c.db) +
+		" sub=" + strconv.Itoa(len(c.subs)) +
+		" psub=" + strconv.Itoa(len(c.psubs)) +
+		" multi=" + strconv.Itoa(multi) +
+		" cmd=" + c.lastCmd +
+		" resp=" + strconv.Itoa(c.w.proto)
+}
+
+func (c *conn) cmdEcho(args []string) {
+	c.w.bulk(args[0])
+}
+
+func (c *conn) cmdHello(args []string) {
+	proto := c.w.proto
+	name := c.name
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			c.w.err("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if n != 2 && n != 3 {
+			c.w.err("NOPROTO unsupported protocol version")
+			return
+		}
+		proto = n
+		for i := 1; i < len(args); i++ {
+			switch opt := strings.ToLower(args[i]); {
+			case opt == "auth" && i+2 < len(args):
+				i += 2
+			case opt == "setname" && i+1 < len(args):
+				i++
+				if !validName(args[i]) {
+					c.w.err("ERR Client names cannot contain spaces, newlines or special characters.")
+					return
+				}
+				name = args[i]
+			default:
+				c.w.err("ERR Syntax error in HELLO option '" + args[i] + "'")
+				return
+			}
+		}
+	}
+	c.w.proto = proto
+	c.name = name
+	c.w.mapHeader(7)
+	c.w.bulk("server")
+	c.w.bulk("redis")
+	c.w.bulk("version")
+	c.w.bulk(version)
+	c.w.bulk("proto")
+	c.w.int(int64(proto))
+	c.w.bulk("id")
+	c.w.int(c.id)
+	c.w.bulk("mode")
+	c.w.bulk("standalone")
+	c.w.bulk("role")
+	c.w.bulk("master")
+	c.w.bulk("modules")
+	c.w.array(0)
+}
+
+func (c *conn) cmdPing(args []string) {
+	if c.subscribed() {
+		msg := ""
+		if len(args) > 0 {
+			msg = args[0]
+		}
+		c.w.bulks([]string{"pong", msg})
+		return
+	}
+	if len(args) > 0 {
+		c.w.bulk(args[0])
+		return
+	}
+	c.w.simple("PONG")
+}
+
+func (c *conn) cmdQuit(args []string) {
+	c.quit = true
+	c.w.ok()
+}
+
+func (c *conn) cmdSelect(args []string) {
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		c.w.err(errNotInteger)
+		return
+	}
+	if n < 0 || n > 15 {
+		c.w.err("ERR DB index is out of range")
+		return
+	}
+	c.db = n
+	c.w.ok()
+}
+
+func (c *conn) cmdDBSize(args []string) {
+	var n int64
+	for key := range c.keys() {
+		if c.lookup(key) != nil {
+			n++
+		}
+	}
+	c.w.int(n)
+}
+
+func (c *conn) cmdFlushAll(args []string) {
+	c.s.dbs = make(map[int]map[string]*item)
+	c.w.ok()
+}
+
+func (c *conn) cmdFlushDB(args []string) {
+	delete(c.s.dbs, c.db)
+	c.w.ok()
+}
+
+func (c *conn) cmdWait(args []string) {
+	if _, ok := parseInt(args[0]); !ok {
+		c.w.err(errNotInteger)
+		return
+	}
+	if _, ok := parseInt(args[1]); !ok {
+		c.w.err("ERR timeout is not an integer or out of range")
+		return
+	}
+	// there are no replicas
+	c.w.int(0)
+}
+
+func (c *conn) cmdDel(args []string) {
+	var n int64
+	for _, key := range args {
+		if c.lookup(key) != nil {
+			delete(c.keys(), key)
+			n++
+		}
+	}
+	c.w.int(n)
+}
+
+func (c *conn) cmdExists(args []string) {
+	var n int64
+	for _, key := range args {
+		if c.lookup(key) != nil {
+			n++
+		}
+	}
+	c.w.int(n)
+}
+
+func (c *conn) cmdExpire(args []string) {
+	c.expire(args, time.Second)
+}
+
+func (c *conn) cmdPExpire(args []string) {
+	c.expire(args, time.Millisecond)
+}
+
+func (c *conn) expire(args []string, unit time.Duration) {
+	n, ok := parseInt(args[1])
+	if !ok {
+		c.w.err(errNotInteger)
+		return
+	}
+	it := c.lookup(args[0])
+	if it == nil {
+		c.w.int(0)
+		return
+	}
+	if n <= 0 {
+		delete(c.keys(), args[0])
+	} else {
+		it.expireAt = time.Now().Add(time.Duration(n) * unit)
+	}
+	c.w.int(1)
+}
+
+func (c *conn) cmdKeys(args []string) {
+	var keys []string
+	for key := range c.keys() {
+		if c.lookup(key) != nil && match(args[0], key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	c.w.bulks(keys)
+}
+
+func (c *conn) cmdPersist(args []string) {
+	it := c.lookup(args[0])
+	if it == nil || it.expireAt.IsZero() {
+		c.w.int(0)
+		return
+	}
+	it.expireAt = time.Time{}
+	c.w.int(1)
+}
+
+func (c *conn) cmdTTL(args []string) {
+	c.ttl(args[0], time.Second)
+}
+
+func (c *conn) cmdPTTL(args []string) {
+	c.ttl(args[0], time.Millisecond)
+}
+
+func (c *conn) ttl(key string, unit time.Duration) {
+	it := c.lookup(key)
+	switch {
+	case it == nil:
+		c.w.int(-2)
+	case it.expireAt.IsZero():
+		c.w.int(-1)
+	default:
+		c.w.int(int64((time.Until(it.expireAt) + unit/2) / unit))
+	}
+}
+
+func (c *conn) cmdType(args []string) {
+	it := c.lookup(args[0])
+	if it == nil {
+		c.w.simple("none")
+		return
+	}
+	c.w.simple(kindOf(it.value))
+}
+
+func (c *conn) cmdAppend(args []string) {
+	it, ok := c.lookupKind(args[0], kindString)
+	if !ok {
+		return
+	}
+	if it == nil {
+		it = &item{value: ""}
+		c.keys()[args[0]] = it
+	}
+	s := it.value.(string) + args[1]
+	it.value = s
+	c.w.int(int64(len(s)))
+}
+
+func (c *conn) cmdGet(args []string) {
+	it, ok := c.lookupKind(args[0], kindString)
+	if !ok {
+		return
+	}
+	if it == nil {
+		c.w.null()
+		return
+	}
+	c.w.bulk(it.value.(string))
+}
+
+func (c *conn) cmdMGet(args []string) {
+	c.w.array(len(args))
+	for _, key := range args {
+		it := c.lookup(key)
+		if s, ok := valueOf(it).(string); ok {
+			c.w.bulk(s)
+		} else {
+			c.w.null()
+		}
+	}
+}
+
+func valueOf(it *item) interface{} {
+	if it == nil {
+		return nil
+	}
+	return it.value
+}
+
+func (c *conn) cmdMSet(args []string) {
+	if len(args)%2 != 0 {
+		c.w.err("ERR wrong number of arguments for 'mset' command")
+		return
+	}
+	for i := 0; i < len(args); i += 2 {
+		c.keys()[args[i]] = &item{value: args[i+1]}
+	}
+	c.w.ok()
+}
+
+func (c *conn) cmdSet(args []string) {
+	key, value := args[0], args[1]
+	var (
+		nx, xx, keepTTL, get bool
+		expireAt             time.Time
+	)
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToLower(args[i]); opt {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "keepttl":
+			keepTTL = true
+		case "get":
+			get = true
+		case "ex", "px":
+			if i+1 == len(args) || !expireAt.IsZero() {
+				c.w.err(errSyntax)
+				return
+			}
+			i++
+			n, ok := parseInt(args[i])
+			if !ok {
+				c.w.err(errNotInteger)
+				return
+			}
+			if n <= 0 {
+				c.w.err("ERR invalid expire time in 'set' command")
+				return
+			}
+			unit := time.Second
+			if opt == "px" {
+				unit = time.Millisecond
+			}
+			expireAt = time.Now().Add(time.Duration(n) * unit)
+		default:
+			c.w.err(errSyntax)
+			return
+		}
+	}
+	if (nx && xx) || (keepTTL && !expireAt.IsZero()) {
+		c.w.err(errSyntax)
+		return
+	}
+	prev := c.lookup(key)
+	if get && prev != nil && kindOf(prev.value) != kindString {
+		c.w.err(errWrongType)
+		return
+	}
+	if (nx && prev != nil) || (xx && prev == nil) {
+		if get {
+			c.writeString(prev)
+		} else {
+			c.w.null()
+		}
+		return
+	}
+	it := &item{value: value, expireAt: expireAt}
+	if keepTTL && prev != nil {
+		it.expireAt = prev.expireAt
+	}
+	c.keys()[key] = it
+	if get {
+		c.writeString(prev)
+		return
+	}
+	c.w.ok()
+}
+
+// writeString writes the string value of it, or a null if it is nil.
+func (c *conn) writeString(it *item) {
+	if it == nil {
+		c.w.null()
+		return
+	}
+	c.w.bulk(it.value.(string))
+}
+
+func (c *conn) cmdStrlen(args []string) {
+	it, ok := c.lookupKind(args[0], kindString)
+	if !ok {
+		return
+	}
+	if it == nil {
+		c.w.int(0)
+		return
+	}
+	c.w.int(int64(len(it.value.(string))))
+}
+
+func (c *conn) cmdIncr(args []string) {
+	c.incrBy(args[0], 1)
+}
+
+func (c *conn) cmdDecr(args []string) {
+	c.incrBy(args[0], -1)
+}
+
+func (c *conn) cmdIncrBy(args []string) {
+	n, ok := parseInt(args[1])
+	if !ok {
+		c.w.err(errNotInteger)
+		return
+	}
+	c.incrBy(args[0], n)
+}
+
+func (c *conn) cmdDecrBy(args []string) {
+	n, ok := parseInt(args[1])
+	if !ok {
+		c.w.err(errNotInteger)
+		return
+	}
+	c.incrBy(args[0], -n)
+}
+
+func (c *conn) incrBy(key string, delta int64) {
+	it, ok := c.lookupKind(key, kindString)
+	if !ok {
+		return
+	}
+	var n int64
+	if it != nil {
+		if n, ok = parseInt(it.value.(string)); !ok {
+			c.w.err(errNotInteger)
+			return
+		}
+	} else {
+		it = &item{}
+		c.keys()[key] = it
+	}
+	n += delta
+	it.value = strconv.FormatInt(n, 10)
+	c.w.int(n)
+}
+
+// hash returns the hash stored under key, creating it if create is true.
+func (c *conn) hash(key string, create bool) (map[string]string, bool) {
+	it, ok := c.lookupKind(key, kindHash)
+	if !ok {
+		return nil, false
+	}
+	if it == nil {
+		if !create {
+			return nil, true
+		}
+		it = &item{value: make(map[string]string)}
+		c.keys()[key] = it
+	}
+	return it.value.(map[string]string), true
+}
+
+func (c *conn) cmdHDel(args []string) {
+	h, ok := c.hash(args[0], false)
+	if !ok {
+		return
+	}
+	var n int64
+	for _, field := range args[1:] {
+		if _, ok := h[field]; ok {
+			delete(h, field)
+			n++
+		}
+	}
+	if h != nil && len(h) == 0 {
+		delete(c.keys(), args[0])
+	}
+	c.w.int(n)
+}
+
+func (c *conn) cmdHExists(args []string) {
+	h, ok := c.hash(args[0], false)
+	if !ok {
+		return
+	}
+	if _, ok := h[args[1]]; ok {
+		c.w.int(1)
+		return
+	}
+	c.w.int(0)
+}
+
+func (c *conn) cmdHGet(args []string) {
+	h, ok := c.hash(args[0], false)
+	if !ok {
+		return
+	}
+	v, ok := h[args[1]]
+	if !ok {
+		c.w.null()
+		return
+	}
+	c.w.bulk(v)
+}
+
+func (c *conn) cmdHGetAll(args []string) {
+	h, ok := c.hash(args[0], false)
+	if !ok {
+		return
+	}
+	fields := sortedFields(h)
+	c.w.mapHeader(len(fields))
+	for _, f := range fields {
+		c.w.bulk(f)
+		c.w.bulk(h[f])
+	}
+}
+
+func sortedFields(h map[string]string) []string {
+	fields := make([]string, 0, len(h))
+	for f := range h {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func (c *conn) cmdHIncrBy(args []string) {
+	delta, ok := parseInt(args[2])
+	if !ok {
+		c.w.err(errNotInteger)
+		return
+	}
+	h, ok := c.hash(args[0], true)
+	if !ok {
+		return
+	}
+	var n int64
+	if v, exists := h[args[1]]; exists {
+		if n, ok = parseInt(v); !ok {
+			c.w.err("ERR hash value is not an integer")
+			return
+		}
+	}
+	n += delta
+	h[args[1]] = strconv.FormatInt(n, 10)
+	c.w.int(n)
+}
+
+func (c *conn) cmdHKeys(args []string) {
+	h, ok := c.hash(args[0], false)
+	if !ok {
+		return
+	}
+	c.w.bulks(sortedFields(h))
+}
+
+func (c *conn) cmdHLen(args []string) {
+	h, ok := c.hash(args[0], false)
+	if !ok {
+		return
+	}
+	c.w.int(int64(len(h)))
+}
+
+func (c *conn) cmdHMGet(args []string) {
+	h, ok := c.hash(args[0], false)
+	if !ok {
+		return
+	}
+	c.w.array(len(args) - 1)
+	for _, field := range args[1:] {
+		if v, ok := h[field]; ok {
+			c.w.bulk(v)
+		} else {
+			c.w.null()
+		}
+	}
+}
+
+func (c *conn) cmdHMSet(args []string) {
+	if c.hset(args, "hmset") {
+		c.w.ok()
+	}
+}
+
+func (c *conn) cmdHSet(args []string) {
+	h := c.lookup(args[0])
+	var before int
+	if h != nil {
+		if m, ok := h.value.(map[string]string); ok {
+			before = len(m)
+		}
+	}
+	if !c.hset(args, "hset") {
+		return
+	}
+	h = c.lookup(args[0])
+	c.w.int(int64(len(h.value.(map[string]string)) - before))
+}
+
+// hset sets the field value pairs of args, where args[0] is the key, and
+// reports whether it succeeded. Otherwise, it writes an error.
+func (c *conn) hset(args []string, name string) bool {
+	if len(args)%2 != 1 {
+		c.w.err("ERR wrong number of arguments for '" + name + "' command")
+		return false
+	}
+	h, ok := c.hash(args[0], true)
+	if !ok {
+		return false
+	}
+	for i := 1; i < len(args); i += 2 {
+		h[args[i]] = args[i+1]
+	}
+	return true
+}
+
+func (c *conn) cmdHVals(args []string) {
+	h, ok := c.hash(args[0], false)
+	if !ok {
+		return
+	}
+	fields := sortedFields(h)
+	vals := make([]string, len(fields))
+	for i, f := range fields {
+		vals[i] = h[f]
+	}
+	c.w.bulks(vals)
+}
+
+// list returns the list stored under key.
+func (c *conn) list(key string) ([]string, bool) {
+	it, ok := c.lookupKind(key, kindList)
+	if !ok || it == nil {
+		return nil, ok
+	}
+	return it.value.([]string), true
+}
+
+// setList stores l under key, removing the key if l is empty.
+func (c *conn) setList(key string, l []string) {
+	if len(l) == 0 {
+		delete(c.keys(), key)
+		return
+	}
+	if it := c.lookup(key); it != nil {
+		it.value = l
+		return
+	}
+	c.keys()[key] = &item{value: l}
+}
+
+func (c *conn) cmdLPush(args []string) {
+	c.push(args, true)
+}
+
+func (c *conn) cmdRPush(args []string) {
+	c.push(args, false)
+}
+
+func (c *conn) push(args []string, left bool) {
+	l, ok := c.list(args[0])
+	if !ok {
+		return
+	}
+	for _, v := range args[1:] {
+		if left {
+			l = append([]string{v}, l...)
+		} else {
+			l = append(l, v)
+		}
+	}
+	c.setList(args[0], l)
+	c.s.notify()
+	c.w.int(int64(len(l)))
+}
+
+func (c *conn) cmdLPop(args []string) {
+	c.pop(args, true)
+}
+
+func (c *conn) cmdRPop(args []string) {
+	c.pop(args, false)
+}
+
+func (c *conn) pop(args []string, left bool) {
+	count := int64(-1)
+	if len(args) > 1 {
+		n, ok := parseInt(args[1])
+		if !ok || n < 0 {
+			c.w.err("ERR value is out of range, must be positive")
+			return
+		}
+		count = n
+	}
+	l, ok := c.list(args[0])
+	if !ok {
+		return
+	}
+	if l == nil {
+		if count >= 0 {
+			c.w.nullArray()
+		} else {
+			c.w.null()
+		}
+		return
+	}
+	n := 1
+	if count >= 0 && count < int64(len(l)) {
+		n = int(count)
+	} else if count >= 0 {
+		n = len(l)
+	}
+	values := make([]string, n)
+	for i := range values {
+		if left {
+			values[i], l = l[0], l[1:]
+		} else {
+			values[i], l = l[len(l)-1], l[:len(l)-1]
+		}
+	}
+	c.setList(args[0], l)
+	if count < 0 {
+		c.w.bulk(values[0])
+		return
+	}
+	c.w.bulks(values)
+}
+
+func (c *conn) cmdBLPop(args []string) {
+	c.blockingPop(args, true)
+}
+
+func (c *conn) cmdBRPop(args []string) {
+	c.blockingPop(args, false)
+}
+
+// blockingPop pops a value from the first non-empty list of args, waiting
+// until the timeout of the last argument for one to be pushed.
+func (c *conn) blockingPop(args []string, left bool) {
+	keys := args[:len(args)-1]
+	timeout, err := strconv.ParseFloat(args[len(args)-1], 64)
+	if err != nil || timeout < 0 {
+		c.w.err("ERR timeout is not a float or out of range")
+		return
+	}
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(time.Duration(timeout * float64(time.Second)))
+	}
+	for {
+		for _, key := range keys {
+			l, ok := c.list(key)
+			if !ok {
+				return
+			}
+			if len(l) == 0 {
+				continue
+			}
+			var v string
+			if left {
+				v, l = l[0], l[1:]
+			} else {
+				v, l = l[len(l)-1], l[:len(l)-1]
+			}
+			c.setList(key, l)
+			c.w.bulks([]string{key, v})
+			return
+		}
+		// blocking commands do not block within transactions
+		if c.inExec || !c.s.wait(deadline) {
+			c.w.nullArray()
+			return
+		}
+	}
+}
+
+func (c *conn) cmdLIndex(args []string) {
+	i, ok := parseInt(args[1])
+	if !ok {
+		c.w.err(errNotInteger)
+		return
+	}
+	l, ok := c.list(args[0])
+	if !ok {
+		return
+	}
+	if i < 0 {
+		i += int64(len(l))
+	}
+	if i < 0 || i >= int64(len(l)) {
+		c.w.null()
+		return
+	}
+	c.w.bulk(l[i])
+}
+
+func (c *conn) cmdLLen(args []string) {
+	l, ok := c.list(args[0])
+	if !ok {
+		return
+	}
+	c.w.int(int64(len(l)))
+}
+
+func (c *conn) cmdLRange(args []string) {
+	start, ok1 := parseInt(args[1])
+	stop, ok2 := parseInt(args[2])
+	if !ok1 || !ok2 {
+		c.w.err(errNotInteger)
+		return
+	}
+	l, ok := c.list(args[0])
+	if !ok {
+		return
+	}
+	n := int64(len(l))
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		c.w.array(0)
+		return
+	}
+	c.w.bulks(l[start : stop+1])
+}
+
+func (c *conn) cmdMulti(args []string) {
+	if c.multi {
+		c.w.err("ERR MULTI calls can not be nested")
+		return
+	}
+	c.multi = true
+	c.w.ok()
+}
+
+// queue queues a command between MULTI and EXEC. Invalid commands abort the
+// transaction.
+func (c *conn) queue(name string, args []string) {
+	cmd, ok := commands[name]
+	switch {
+	case !ok:
+		c.dirty = true
+		c.w.err(unknownCommand(args))
+	case len(args) < cmd.arity:
+		c.dirty = true
+		c.w.err("ERR wrong number of arguments for '" + name + "' command")
+	default:
+		c.queued = append(c.queued, args)
+		c.w.simple("QUEUED")
+	}
+}
+
+func (c *conn) cmdExec(args []string) {
+	if !c.multi {
+		c.w.err("ERR EXEC without MULTI")
+		return
+	}
+	queued, dirty := c.queued, c.dirty
+	c.multi, c.dirty, c.queued = false, false, nil
+	if dirty {
+		c.w.err("EXECABORT Transaction discarded because of previous errors.")
+		return
+	}
+	c.inExec = true
+	defer func() { c.inExec = false }()
+	c.w.array(len(queued))
+	for _, args := range queued {
+		c.call(strings.ToLower(args[0]), args)
+	}
+}
+
+func (c *conn) cmdDiscard(args []string) {
+	if !c.multi {
+		c.w.err("ERR DISCARD without MULTI")
+		return
+	}
+	c.multi, c.dirty, c.queued = false, false, nil
+	c.w.ok()
+}
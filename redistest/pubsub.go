@@ -0,0 +1,172 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redistest
+
+import (
+	"sort"
+	"strings"
+)
+
+func (c *conn) cmdSubscribe(args []string) {
+	for _, channel := range args {
+		c.subs[channel] = true
+		c.writeSubscription("subscribe", channel)
+	}
+}
+
+func (c *conn) cmdPSubscribe(args []string) {
+	for _, pattern := range args {
+		c.psubs[pattern] = true
+		c.writeSubscription("psubscribe", pattern)
+	}
+}
+
+func (c *conn) cmdUnsubscribe(args []string) {
+	c.unsubscribe("unsubscribe", c.subs, args)
+}
+
+func (c *conn) cmdPUnsubscribe(args []string) {
+	c.unsubscribe("punsubscribe", c.psubs, args)
+}
+
+// unsubscribe removes the given channels or patterns from subs, or all of them
+// if none is given.
+func (c *conn) unsubscribe(kind string, subs map[string]bool, args []string) {
+	if len(args) == 0 {
+		for name := range subs {
+			args = append(args, name)
+		}
+		sort.Strings(args)
+	}
+	if len(args) == 0 {
+		c.w.push(3)
+		c.w.bulk(kind)
+		c.w.null()
+		c.w.int(0)
+		return
+	}
+	for _, name := range args {
+		delete(subs, name)
+		c.writeSubscription(kind, name)
+	}
+}
+
+func (c *conn) writeSubscription(kind, name string) {
+	c.w.push(3)
+	c.w.bulk(kind)
+	c.w.bulk(name)
+	c.w.int(int64(len(c.subs) + len(c.psubs)))
+}
+
+func (c *conn) cmdPublish(args []string) {
+	channel, message := args[0], args[1]
+	var n int64
+	for other := range c.s.conns {
+		if other.subs[channel] {
+			other.send(func(w *writer) {
+				w.push(3)
+				w.bulk("message")
+				w.bulk(channel)
+				w.bulk(message)
+			})
+			n++
+		}
+		for pattern := range other.psubs {
+			if !match(pattern, channel) {
+				continue
+			}
+			pattern := pattern
+			other.send(func(w *writer) {
+				w.push(4)
+				w.bulk("pmessage")
+				w.bulk(pattern)
+				w.bulk(channel)
+				w.bulk(message)
+			})
+			n++
+		}
+	}
+	c.w.int(n)
+}
+
+// match reports whether s matches the glob-style pattern, as used by KEYS and
+// PSUBSCRIBE.
+func match(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if match(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		case '[':
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				if len(s) == 0 || s[0] != '[' {
+					return false
+				}
+				break
+			}
+			if len(s) == 0 || !matchClass(pattern[1:end+1], s[0]) {
+				return false
+			}
+			pattern = pattern[end+1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		s = s[1:]
+	}
+	return len(s) == 0
+}
+
+// matchClass reports whether b belongs to a character class such as "abc",
+// "a-z" or "^0-9".
+func matchClass(class string, b byte) bool {
+	negate := strings.HasPrefix(class, "^")
+	if negate {
+		class = class[1:]
+	}
+	matched := false
+	for i := 0; i < len(class); i++ {
+		switch {
+		case class[i] == '\\' && i+1 < len(class):
+			i++
+			matched = matched || class[i] == b
+		case i+2 < len(class) && class[i+1] == '-':
+			lo, hi := class[i], class[i+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			matched = matched || (b >= lo && b <= hi)
+			i += 2
+		default:
+			matched = matched || class[i] == b
+		}
+	}
+	return matched != negate
+}
@@ -0,0 +1,156 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redistest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxBulkLength is the maximum length of the arguments of a command.
+const maxBulkLength = 512 << 20
+
+var errProtocol = errors.New("ERR Protocol error")
+
+// readCommand reads a command, either as an array of bulk strings or as an
+// inline command.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > 1024*1024 {
+		return nil, errProtocol
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errProtocol
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxBulkLength {
+			return nil, errProtocol
+		}
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		if b[size] != '\r' || b[size+1] != '\n' {
+			return nil, errProtocol
+		}
+		args = append(args, string(b[:size]))
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// writer encodes replies in the protocol version negotiated by the client.
+// Types missing from RESP2 are encoded like Redis does, for instance maps as
+// flat arrays and nulls as null bulk strings.
+type writer struct {
+	buf   bytes.Buffer
+	proto int
+}
+
+func (w *writer) header(prefix byte, n int) {
+	w.buf.WriteByte(prefix)
+	w.buf.WriteString(strconv.Itoa(n))
+	w.buf.WriteString("\r\n")
+}
+
+func (w *writer) simple(s string) {
+	w.buf.WriteByte('+')
+	w.buf.WriteString(s)
+	w.buf.WriteString("\r\n")
+}
+
+func (w *writer) ok() {
+	w.simple("OK")
+}
+
+// err writes an error reply. msg should start with an error prefix such as
+// "ERR" or "WRONGTYPE".
+func (w *writer) err(msg string) {
+	w.buf.WriteByte('-')
+	w.buf.WriteString(strings.NewReplacer("\r", " ", "\n", " ").Replace(msg))
+	w.buf.WriteString("\r\n")
+}
+
+func (w *writer) int(n int64) {
+	w.buf.WriteByte(':')
+	w.buf.WriteString(strconv.FormatInt(n, 10))
+	w.buf.WriteString("\r\n")
+}
+
+func (w *writer) bulk(s string) {
+	w.header('$', len(s))
+	w.buf.WriteString(s)
+	w.buf.WriteString("\r\n")
+}
+
+func (w *writer) null() {
+	if w.proto == 3 {
+		w.buf.WriteString("_\r\n")
+		return
+	}
+	w.buf.WriteString("$-1\r\n")
+}
+
+func (w *writer) nullArray() {
+	if w.proto == 3 {
+		w.buf.WriteString("_\r\n")
+		return
+	}
+	w.buf.WriteString("*-1\r\n")
+}
+
+func (w *writer) array(n int) {
+	w.header('*', n)
+}
+
+// mapHeader starts a map of n pairs.
+func (w *writer) mapHeader(n int) {
+	if w.proto == 3 {
+		w.header('%', n)
+		return
+	}
+	w.header('*', 2*n)
+}
+
+// push starts an out-of-band message of n elements, such as a Pub/Sub message.
+func (w *writer) push(n int) {
+	if w.proto == 3 {
+		w.header('>', n)
+		return
+	}
+	w.header('*', n)
+}
+
+func (w *writer) bulks(values []string) {
+	w.array(len(values))
+	for _, v := range values {
+		w.bulk(v)
+	}
+}
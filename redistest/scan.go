@@ -0,0 +1,164 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redistest
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultScanCount is the number of elements examined by the SCAN commands
+// when COUNT is not given, as in Redis.
+const defaultScanCount = 10
+
+// scanArgs are the cursor and the options of a SCAN command. The cursor is
+// the offset of the next element to examine, in the order of the elements.
+type scanArgs struct {
+	cursor  int
+	pattern string
+	count   int
+	kind    string
+}
+
+// parseScan parses the cursor and the options of a SCAN command, accepting
+// the TYPE option if typeOption is true. Otherwise, it writes an error and
+// returns false.
+func (c *conn) parseScan(args []string, typeOption bool) (scanArgs, bool) {
+	a := scanArgs{count: defaultScanCount}
+	cursor, err := strconv.Atoi(args[0])
+	if err != nil || cursor < 0 {
+		c.w.err("ERR invalid cursor")
+		return a, false
+	}
+	a.cursor = cursor
+	args = args[1:]
+	for len(args) > 0 {
+		if len(args) < 2 {
+			c.w.err(errSyntax)
+			return a, false
+		}
+		switch strings.ToLower(args[0]) {
+		case "match":
+			a.pattern = args[1]
+		case "count":
+			n, ok := parseInt(args[1])
+			if !ok {
+				c.w.err(errNotInteger)
+				return a, false
+			}
+			if n < 1 {
+				c.w.err(errSyntax)
+				return a, false
+			}
+			a.count = int(n)
+		case "type":
+			if !typeOption {
+				c.w.err(errSyntax)
+				return a, false
+			}
+			a.kind = strings.ToLower(args[1])
+		default:
+			c.w.err(errSyntax)
+			return a, false
+		}
+		args = args[2:]
+	}
+	return a, true
+}
+
+// page returns the elements of the page of the given sorted elements starting
+// at the cursor of a, which match its pattern, and the cursor of the next
+// page, which is 0 after the last page.
+func (a scanArgs) page(elements []string) ([]string, int) {
+	if a.cursor >= len(elements) {
+		return nil, 0
+	}
+	end := a.cursor + a.count
+	next := end
+	if end >= len(elements) {
+		end = len(elements)
+		next = 0
+	}
+	var page []string
+	for _, e := range elements[a.cursor:end] {
+		if a.pattern == "" || match(a.pattern, e) {
+			page = append(page, e)
+		}
+	}
+	return page, next
+}
+
+// writeScan writes the reply to a SCAN command: the next cursor and the
+// elements of the page.
+func (c *conn) writeScan(next int, elements []string) {
+	c.w.array(2)
+	c.w.bulk(strconv.Itoa(next))
+	c.w.bulks(elements)
+}
+
+func (c *conn) cmdScan(args []string) {
+	a, ok := c.parseScan(args, true)
+	if !ok {
+		return
+	}
+	var keys []string
+	for key := range c.keys() {
+		if it := c.lookup(key); it != nil && (a.kind == "" || kindOf(it.value) == a.kind) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	page, next := a.page(keys)
+	c.writeScan(next, page)
+}
+
+func (c *conn) cmdHScan(args []string) {
+	a, ok := c.parseScan(args[1:], false)
+	if !ok {
+		return
+	}
+	h, ok := c.hash(args[0], false)
+	if !ok {
+		return
+	}
+	fields, next := a.page(sortedFields(h))
+	reply := make([]string, 0, 2*len(fields))
+	for _, f := range fields {
+		reply = append(reply, f, h[f])
+	}
+	c.writeScan(next, reply)
+}
+
+func (c *conn) cmdSScan(args []string) {
+	a, ok := c.parseScan(args[1:], false)
+	if !ok {
+		return
+	}
+	s, ok := c.set(args[0], false)
+	if !ok {
+		return
+	}
+	members, next := a.page(s.sortedMembers())
+	c.writeScan(next, members)
+}
+
+func (c *conn) cmdZScan(args []string) {
+	a, ok := c.parseScan(args[1:], false)
+	if !ok {
+		return
+	}
+	z, ok := c.zset(args[0], false)
+	if !ok {
+		return
+	}
+	members, next := a.page(z.sortedMembers())
+	reply := make([]string, 0, 2*len(members))
+	for _, m := range members {
+		reply = append(reply, m, formatScore(z[m]))
+	}
+	c.writeScan(next, reply)
+}
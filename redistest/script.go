@@ -0,0 +1,268 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redistest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// errUnsupportedScript is returned for scripts which are not of the form
+// "return <value>", where the value is an integer, a string, nil, KEYS[i],
+// ARGV[i] or a table of such values.
+var errUnsupportedScript = errors.New("ERR Error compiling script: only scripts returning literals, KEYS or ARGV are supported")
+
+// scriptValue is a value returned by a script.
+type scriptValue struct {
+	// kind is one of "int", "string", "nil", "KEYS", "ARGV" or "table".
+	kind  string
+	i     int64
+	s     string
+	elems []scriptValue
+}
+
+// eval returns the reply of v: an int64, a string, a []interface{} or nil.
+func (v scriptValue) eval(keys, argv []string) interface{} {
+	switch v.kind {
+	case "int":
+		return v.i
+	case "string":
+		return v.s
+	case "KEYS", "ARGV":
+		values := keys
+		if v.kind == "ARGV" {
+			values = argv
+		}
+		if v.i < 1 || v.i > int64(len(values)) {
+			return nil
+		}
+		return values[v.i-1]
+	case "table":
+		var elems []interface{}
+		for _, e := range v.elems {
+			r := e.eval(keys, argv)
+			if r == nil {
+				// like Lua arrays, tables end at their first nil
+				break
+			}
+			elems = append(elems, r)
+		}
+		return elems
+	}
+	return nil
+}
+
+type scriptParser struct {
+	src string
+	pos int
+}
+
+func parseScript(src string) (scriptValue, error) {
+	p := &scriptParser{src: src}
+	p.skipSpace()
+	if !p.consume("return") {
+		return scriptValue{}, errUnsupportedScript
+	}
+	v, err := p.value()
+	if err != nil {
+		return scriptValue{}, err
+	}
+	p.skipSpace()
+	p.consume(";")
+	p.skipSpace()
+	if p.pos != len(p.src) {
+		return scriptValue{}, errUnsupportedScript
+	}
+	return v, nil
+}
+
+func (p *scriptParser) skipSpace() {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *scriptParser) consume(s string) bool {
+	if strings.HasPrefix(p.src[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+func (p *scriptParser) value() (scriptValue, error) {
+	p.skipSpace()
+	switch {
+	case p.consume("{"):
+		return p.table()
+	case p.consume("KEYS["):
+		return p.index("KEYS")
+	case p.consume("ARGV["):
+		return p.index("ARGV")
+	case p.consume("nil"):
+		return scriptValue{kind: "nil"}, nil
+	case p.pos < len(p.src) && (p.src[p.pos] == '\'' || p.src[p.pos] == '"'):
+		return p.string()
+	}
+	n, ok := p.int()
+	if !ok {
+		return scriptValue{}, errUnsupportedScript
+	}
+	return scriptValue{kind: "int", i: n}, nil
+}
+
+func (p *scriptParser) table() (scriptValue, error) {
+	v := scriptValue{kind: "table"}
+	for {
+		p.skipSpace()
+		if p.consume("}") {
+			return v, nil
+		}
+		e, err := p.value()
+		if err != nil {
+			return scriptValue{}, err
+		}
+		v.elems = append(v.elems, e)
+		p.skipSpace()
+		if !p.consume(",") && !p.consume(";") {
+			if p.consume("}") {
+				return v, nil
+			}
+			return scriptValue{}, errUnsupportedScript
+		}
+	}
+}
+
+func (p *scriptParser) index(kind string) (scriptValue, error) {
+	p.skipSpace()
+	n, ok := p.int()
+	p.skipSpace()
+	if !ok || !p.consume("]") {
+		return scriptValue{}, errUnsupportedScript
+	}
+	return scriptValue{kind: kind, i: n}, nil
+}
+
+func (p *scriptParser) int() (int64, bool) {
+	start := p.pos
+	if p.pos < len(p.src) && p.src[p.pos] == '-' {
+		p.pos++
+	}
+	for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+		p.pos++
+	}
+	n, err := strconv.ParseInt(p.src[start:p.pos], 10, 64)
+	return n, err == nil
+}
+
+func (p *scriptParser) string() (scriptValue, error) {
+	quote := p.src[p.pos]
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		ch := p.src[p.pos]
+		p.pos++
+		switch {
+		case ch == quote:
+			return scriptValue{kind: "string", s: b.String()}, nil
+		case ch == '\\' && p.pos < len(p.src):
+			b.WriteByte(p.src[p.pos])
+			p.pos++
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return scriptValue{}, errUnsupportedScript
+}
+
+func scriptSHA(src string) string {
+	sum := sha1.Sum([]byte(src))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *conn) cmdEval(args []string) {
+	v, err := parseScript(args[0])
+	if err != nil {
+		c.w.err(err.Error())
+		return
+	}
+	c.s.scripts[scriptSHA(args[0])] = args[0]
+	c.runScript(v, args[1:])
+}
+
+func (c *conn) cmdEvalSha(args []string) {
+	src, ok := c.s.scripts[strings.ToLower(args[0])]
+	if !ok {
+		c.w.err("NOSCRIPT No matching script. Please use EVAL.")
+		return
+	}
+	v, _ := parseScript(src)
+	c.runScript(v, args[1:])
+}
+
+// runScript writes the reply of v, where args are the number of keys followed
+// by the keys and the other arguments.
+func (c *conn) runScript(v scriptValue, args []string) {
+	n, ok := parseInt(args[0])
+	switch {
+	case !ok:
+		c.w.err(errNotInteger)
+		return
+	case n < 0:
+		c.w.err("ERR Number of keys can't be negative")
+		return
+	case n > int64(len(args)-1):
+		c.w.err("ERR Number of keys can't be greater than number of args")
+		return
+	}
+	c.writeValue(v.eval(args[1:1+n], args[1+n:]))
+}
+
+func (c *conn) writeValue(v interface{}) {
+	switch v := v.(type) {
+	case int64:
+		c.w.int(v)
+	case string:
+		c.w.bulk(v)
+	case []interface{}:
+		c.w.array(len(v))
+		for _, e := range v {
+			c.writeValue(e)
+		}
+	default:
+		c.w.null()
+	}
+}
+
+func (c *conn) cmdScript(args []string) {
+	switch sub := strings.ToLower(args[0]); {
+	case sub == "load" && len(args) == 2:
+		if _, err := parseScript(args[1]); err != nil {
+			c.w.err(err.Error())
+			return
+		}
+		sha := scriptSHA(args[1])
+		c.s.scripts[sha] = args[1]
+		c.w.bulk(sha)
+	case sub == "exists" && len(args) > 1:
+		c.w.array(len(args) - 1)
+		for _, sha := range args[1:] {
+			if _, ok := c.s.scripts[strings.ToLower(sha)]; ok {
+				c.w.int(1)
+			} else {
+				c.w.int(0)
+			}
+		}
+	case sub == "flush" && len(args) <= 2:
+		c.s.scripts = make(map[string]string)
+		c.w.ok()
+	default:
+		c.w.err("ERR unknown subcommand or wrong number of arguments for '" + args[0] + "'. Try SCRIPT HELP.")
+	}
+}
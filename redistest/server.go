@@ -0,0 +1,349 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+// Package redistest provides an in-process Redis server and assertions on the
+// spans recorded by mocktracer, so that traced clients can be tested
+// deterministically without running Redis.
+//
+// The server speaks RESP2 and RESP3 and implements a subset of the Redis
+// commands: strings, hashes, lists, sets, sorted sets, streams, expiration,
+// SCAN, pipelining, MULTI/EXEC, Pub/Sub, blocking pops and scripts returning
+// literals, KEYS or ARGV. Latency and error replies can be injected to exercise slow and failing
+// commands.
+package redistest
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Server is an in-process Redis server listening on an ephemeral port of the
+// loopback interface.
+type Server struct {
+	ln net.Listener
+
+	mu      sync.Mutex
+	dbs     map[int]map[string]*item
+	scripts map[string]string
+	errors  map[string]string
+	latency time.Duration
+	conns   map[*conn]struct{}
+	nextID  int64
+	changed chan struct{}
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewServer starts a new Server.
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ln:      ln,
+		dbs:     make(map[int]map[string]*item),
+		scripts: make(map[string]string),
+		errors:  make(map[string]string),
+		conns:   make(map[*conn]struct{}),
+		changed: make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// StartServer starts a new Server which is closed when tb and its subtests
+// complete. It fails tb if the server cannot be started.
+func StartServer(tb testing.TB) *Server {
+	tb.Helper()
+	s, err := NewServer()
+	if err != nil {
+		tb.Fatalf("redistest: %v", err)
+	}
+	tb.Cleanup(func() { s.Close() })
+	return s
+}
+
+// Addr returns the address of the server, in the form "host:port".
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Host returns the host of the server.
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Addr())
+	return host
+}
+
+// Port returns the port of the server.
+func (s *Server) Port() string {
+	_, port, _ := net.SplitHostPort(s.Addr())
+	return port
+}
+
+// Close stops the server and closes all its connections.
+func (s *Server) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		err = s.ln.Close()
+		s.mu.Lock()
+		for c := range s.conns {
+			c.nc.Close()
+		}
+		s.mu.Unlock()
+		s.wg.Wait()
+	})
+	return err
+}
+
+// SetLatency delays the reply to every command by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// SetError makes the server reply to the given command with an error, such as
+// "LOADING Redis is loading the dataset in memory" or "READONLY You can't
+// write against a read only replica.". An empty msg removes the error.
+func (s *Server) SetError(command, msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	command = strings.ToLower(command)
+	if msg == "" {
+		delete(s.errors, command)
+		return
+	}
+	s.errors[command] = msg
+}
+
+// FlushAll removes all keys and scripts and all injected errors and latency.
+func (s *Server) FlushAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dbs = make(map[int]map[string]*item)
+	s.scripts = make(map[string]string)
+	s.errors = make(map[string]string)
+	s.latency = 0
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		select {
+		case <-s.closed:
+			s.mu.Unlock()
+			nc.Close()
+			return
+		default:
+		}
+		s.nextID++
+		c := &conn{
+			s:     s,
+			nc:    nc,
+			r:     bufio.NewReader(nc),
+			id:    s.nextID,
+			subs:  make(map[string]bool),
+			psubs: make(map[string]bool),
+		}
+		c.w.proto = 2
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go c.serve()
+	}
+}
+
+// notify wakes up the commands blocked in wait. The caller must hold s.mu.
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// wait releases s.mu until notify is called, the deadline passes or the server
+// is closed. A zero deadline means waiting indefinitely. It reports whether
+// notify was called. The caller must hold s.mu.
+func (s *Server) wait(deadline time.Time) bool {
+	changed := s.changed
+	s.mu.Unlock()
+	defer s.mu.Lock()
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		t := time.NewTimer(time.Until(deadline))
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case <-changed:
+		return true
+	case <-timeout:
+		return false
+	case <-s.closed:
+		return false
+	}
+}
+
+// item is a value stored under a key.
+type item struct {
+	// value is a string, a hash (map[string]string), a list ([]string), a
+	// set, a zset or a *stream.
+	value    interface{}
+	expireAt time.Time
+}
+
+// conn is a client connection.
+type conn struct {
+	s  *Server
+	nc net.Conn
+	r  *bufio.Reader
+	// w buffers the replies to the commands of the connection, which are
+	// written by flush.
+	w writer
+	// wmu serializes the writes to nc, from flush and from the Pub/Sub
+	// messages published by other connections.
+	wmu sync.Mutex
+
+	// The following fields are guarded by s.mu.
+	id      int64
+	db      int
+	name    string
+	lastCmd string
+	multi   bool
+	dirty   bool
+	queued  [][]string
+	inExec  bool
+	subs    map[string]bool
+	psubs   map[string]bool
+	quit    bool
+}
+
+func (c *conn) serve() {
+	defer c.s.wg.Done()
+	defer func() {
+		c.s.mu.Lock()
+		delete(c.s.conns, c)
+		c.s.mu.Unlock()
+		c.nc.Close()
+	}()
+	for {
+		args, err := readCommand(c.r)
+		if err == errProtocol {
+			c.w.err(err.Error())
+			c.flush()
+			return
+		}
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		quit := c.handle(args)
+		// replies to pipelined commands are written together
+		if c.r.Buffered() == 0 || quit {
+			if err := c.flush(); err != nil {
+				return
+			}
+		}
+		if quit {
+			return
+		}
+	}
+}
+
+func (c *conn) flush() error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.w.buf.Len() == 0 {
+		return nil
+	}
+	_, err := c.nc.Write(c.w.buf.Bytes())
+	c.w.buf.Reset()
+	return err
+}
+
+// send writes an out-of-band message to the connection. The caller must hold
+// s.mu.
+func (c *conn) send(fn func(w *writer)) {
+	w := writer{proto: c.w.proto}
+	fn(&w)
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.nc.Write(w.buf.Bytes())
+}
+
+// handle runs a command and reports whether the connection must be closed.
+func (c *conn) handle(args []string) bool {
+	name := strings.ToLower(args[0])
+	c.s.mu.Lock()
+	latency := c.s.latency
+	c.s.mu.Unlock()
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	if c.multi && !transactionCommands[name] {
+		c.queue(name, args)
+		return false
+	}
+	c.call(name, args)
+	return c.quit
+}
+
+// call runs a command. The caller must hold s.mu.
+func (c *conn) call(name string, args []string) {
+	if msg, ok := c.s.errors[name]; ok {
+		c.w.err(msg)
+		return
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		c.w.err(unknownCommand(args))
+		return
+	}
+	if len(args) < cmd.arity {
+		c.w.err("ERR wrong number of arguments for '" + name + "' command")
+		return
+	}
+	if c.subscribed() && !cmd.pubSub {
+		c.w.err("ERR Can't execute '" + name + "': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context")
+		return
+	}
+	c.lastCmd = name
+	cmd.fn(c, args[1:])
+}
+
+// subscribed reports whether the connection is in the Pub/Sub mode of RESP2,
+// where only Pub/Sub commands are allowed.
+func (c *conn) subscribed() bool {
+	return c.w.proto == 2 && len(c.subs)+len(c.psubs) > 0
+}
+
+func unknownCommand(args []string) string {
+	var b strings.Builder
+	b.WriteString("ERR unknown command '")
+	b.WriteString(args[0])
+	b.WriteString("', with args beginning with: ")
+	for _, arg := range args[1:] {
+		b.WriteString("'" + arg + "' ")
+	}
+	return b.String()
+}
@@ -0,0 +1,300 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redistest
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func newClient(t *testing.T) (*Server, *redis.Client) {
+	s := StartServer(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return s, client
+}
+
+func TestStrings(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+	_, client := newClient(t)
+
+	assert.Equal(redis.Nil, client.Get(ctx, "key").Err())
+	assert.Nil(client.Set(ctx, "key", "value", 0).Err())
+	assert.Equal("value", client.Get(ctx, "key").Val())
+	assert.False(client.SetNX(ctx, "key", "other", 0).Val())
+	assert.Equal(int64(1), client.Incr(ctx, "counter").Val())
+	assert.Equal(int64(11), client.IncrBy(ctx, "counter", 10).Val())
+	assert.EqualError(client.Incr(ctx, "key").Err(), "ERR value is not an integer or out of range")
+	assert.Equal([]interface{}{"value", nil}, client.MGet(ctx, "key", "missing").Val())
+
+	assert.True(client.Expire(ctx, "key", time.Hour).Val())
+	assert.Equal(time.Hour, client.TTL(ctx, "key").Val())
+	assert.Nil(client.Set(ctx, "short", "value", time.Millisecond).Err())
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(int64(0), client.Exists(ctx, "short").Val())
+	assert.Equal(int64(2), client.Del(ctx, "key", "counter", "missing").Val())
+}
+
+func TestHashes(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+	_, client := newClient(t)
+
+	assert.Equal(int64(2), client.HSet(ctx, "hash", "a", "1", "b", "2").Val())
+	assert.Equal(int64(0), client.HSet(ctx, "hash", "a", "3").Val())
+	assert.Equal("3", client.HGet(ctx, "hash", "a").Val())
+	assert.Equal(map[string]string{"a": "3", "b": "2"}, client.HGetAll(ctx, "hash").Val())
+	assert.Equal(int64(12), client.HIncrBy(ctx, "hash", "b", 10).Val())
+	assert.Equal(int64(1), client.HDel(ctx, "hash", "a", "c").Val())
+	assert.Equal(int64(1), client.HLen(ctx, "hash").Val())
+	assert.EqualError(client.LPush(ctx, "hash", "a").Err(), "WRONGTYPE Operation against a key holding the wrong kind of value")
+}
+
+func TestLists(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+	_, client := newClient(t)
+
+	assert.Equal(int64(3), client.RPush(ctx, "list", "a", "b", "c").Val())
+	assert.Equal(int64(4), client.LPush(ctx, "list", "z").Val())
+	assert.Equal([]string{"z", "a", "b", "c"}, client.LRange(ctx, "list", 0, -1).Val())
+	assert.Equal("c", client.RPop(ctx, "list").Val())
+	assert.Equal([]string{"list", "z"}, client.BLPop(ctx, time.Second, "list").Val())
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		client.RPush(ctx, "other", "x")
+	}()
+	assert.Equal([]string{"other", "x"}, client.BRPop(ctx, time.Second, "other").Val())
+	assert.Equal(redis.Nil, client.BLPop(ctx, 10*time.Millisecond, "other").Err())
+}
+
+func TestStreams(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+	_, client := newClient(t)
+
+	id, err := client.XAdd(ctx, &redis.XAddArgs{Stream: "stream", ID: "1-1", Values: []string{"a", "1"}}).Result()
+	assert.Nil(err)
+	assert.Equal("1-1", id)
+	assert.NotNil(client.XAdd(ctx, &redis.XAddArgs{Stream: "stream", ID: "1-1", Values: []string{"a", "1"}}).Err())
+	assert.Equal("1-2", client.XAdd(ctx, &redis.XAddArgs{Stream: "stream", ID: "1-*", Values: []string{"b", "2"}}).Val())
+
+	streams, err := client.XRead(ctx, &redis.XReadArgs{Streams: []string{"stream", "1-1"}, Block: -1}).Result()
+	assert.Nil(err)
+	assert.Equal([]redis.XStream{{
+		Stream:   "stream",
+		Messages: []redis.XMessage{{ID: "1-2", Values: map[string]interface{}{"b": "2"}}},
+	}}, streams)
+	_, err = client.XRead(ctx, &redis.XReadArgs{Streams: []string{"stream", "$"}, Block: 10 * time.Millisecond}).Result()
+	assert.Equal(redis.Nil, err)
+	assert.Equal(int64(2), client.XLen(ctx, "stream").Val())
+}
+
+func TestSets(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+	_, client := newClient(t)
+
+	assert.Equal(int64(2), client.SAdd(ctx, "set", "b", "a", "b").Val())
+	assert.Equal(int64(2), client.SCard(ctx, "set").Val())
+	assert.True(client.SIsMember(ctx, "set", "a").Val())
+	assert.Equal([]string{"a", "b"}, client.SMembers(ctx, "set").Val())
+	assert.Equal(int64(1), client.SRem(ctx, "set", "a", "c").Val())
+
+	assert.Equal(int64(2), client.ZAdd(ctx, "zset", &redis.Z{Score: 2, Member: "a"}, &redis.Z{Score: 1.5, Member: "b"}).Val())
+	assert.Equal(int64(0), client.ZAdd(ctx, "zset", &redis.Z{Score: 3, Member: "a"}).Val())
+	assert.Equal(3.0, client.ZScore(ctx, "zset", "a").Val())
+	assert.Equal(int64(2), client.ZCard(ctx, "zset").Val())
+	assert.Equal(int64(1), client.ZRem(ctx, "zset", "a").Val())
+	assert.Equal(redis.Nil, client.ZScore(ctx, "zset", "a").Err())
+	assert.EqualError(client.SAdd(ctx, "zset", "a").Err(), "WRONGTYPE Operation against a key holding the wrong kind of value")
+}
+
+func TestScan(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+	_, client := newClient(t)
+
+	for _, key := range []string{"a1", "a2", "a3", "b1", "b2"} {
+		client.Set(ctx, key, "value", 0)
+	}
+	client.SAdd(ctx, "s", "x", "y")
+	keys, cursor, err := client.Scan(ctx, 0, "a*", 3).Result()
+	assert.Nil(err)
+	assert.Equal([]string{"a1", "a2", "a3"}, keys)
+	assert.Equal(uint64(3), cursor)
+	keys, cursor = client.Scan(ctx, cursor, "a*", 3).Val()
+	assert.Empty(keys)
+	assert.Equal(uint64(0), cursor)
+	keys, _ = client.ScanType(ctx, 0, "", 10, "set").Val()
+	assert.Equal([]string{"s"}, keys)
+
+	var all []string
+	iter := client.Scan(ctx, 0, "", 2).Iterator()
+	for iter.Next(ctx) {
+		all = append(all, iter.Val())
+	}
+	assert.Nil(iter.Err())
+	assert.Equal([]string{"a1", "a2", "a3", "b1", "b2", "s"}, all)
+
+	keys, _ = client.SScan(ctx, "s", 0, "", 10).Val()
+	assert.Equal([]string{"x", "y"}, keys)
+	client.HSet(ctx, "h", "f", "v")
+	keys, _ = client.HScan(ctx, "h", 0, "", 10).Val()
+	assert.Equal([]string{"f", "v"}, keys)
+	client.ZAdd(ctx, "z", &redis.Z{Score: 1, Member: "m"})
+	keys, _ = client.ZScan(ctx, "z", 0, "", 10).Val()
+	assert.Equal([]string{"m", "1"}, keys)
+	assert.EqualError(client.Do(ctx, "scan", "x").Err(), "ERR invalid cursor")
+}
+
+func TestPipelineAndTransaction(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+	_, client := newClient(t)
+
+	cmds, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, "key", "1", 0)
+		pipe.Incr(ctx, "key")
+		pipe.Get(ctx, "key")
+		return nil
+	})
+	assert.Nil(err)
+	assert.Len(cmds, 3)
+	assert.Equal("2", cmds[2].(*redis.StringCmd).Val())
+
+	cmds, err = client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, "key")
+		pipe.LPush(ctx, "key", "a")
+		return nil
+	})
+	assert.NotNil(err)
+	assert.Equal(int64(3), cmds[0].(*redis.IntCmd).Val())
+	assert.EqualError(cmds[1].Err(), "WRONGTYPE Operation against a key holding the wrong kind of value")
+
+	_, err = client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, "key")
+		pipe.Do(ctx, "unknown")
+		return nil
+	})
+	assert.NotNil(err)
+	assert.Equal("3", client.Get(ctx, "key").Val())
+}
+
+func TestScripts(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+	_, client := newClient(t)
+
+	sha, err := client.ScriptLoad(ctx, "return {KEYS[1], ARGV[1], 'x', 42}").Result()
+	assert.Nil(err)
+	assert.Equal([]bool{true}, client.ScriptExists(ctx, sha).Val())
+	res, err := client.EvalSha(ctx, sha, []string{"k"}, "a").Result()
+	assert.Nil(err)
+	assert.Equal([]interface{}{"k", "a", "x", int64(42)}, res)
+	assert.Equal("b", client.Eval(ctx, "return ARGV[2]", nil, "a", "b").Val())
+	assert.NotNil(client.Eval(ctx, "return redis.call('get', KEYS[1])", []string{"k"}).Err())
+
+	assert.Nil(client.ScriptFlush(ctx).Err())
+	err = client.EvalSha(ctx, sha, []string{"k"}, "a").Err()
+	assert.EqualError(err, "NOSCRIPT No matching script. Please use EVAL.")
+}
+
+func TestPubSub(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+	_, client := newClient(t)
+
+	ps := client.PSubscribe(ctx, "news.*")
+	defer ps.Close()
+	_, err := ps.Receive(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(1), client.Publish(ctx, "news.tech", "hello").Val())
+	assert.Equal(int64(0), client.Publish(ctx, "sports", "hello").Val())
+	msg, err := ps.ReceiveMessage(ctx)
+	assert.Nil(err)
+	assert.Equal(&redis.Message{Channel: "news.tech", Pattern: "news.*", Payload: "hello"}, msg)
+}
+
+func TestFaults(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+	s, client := newClient(t)
+
+	s.SetError("get", "LOADING Redis is loading the dataset in memory")
+	assert.EqualError(client.Get(ctx, "key").Err(), "LOADING Redis is loading the dataset in memory")
+	assert.Nil(client.Set(ctx, "key", "value", 0).Err())
+	s.SetError("GET", "")
+	assert.Equal("value", client.Get(ctx, "key").Val())
+
+	s.SetLatency(20 * time.Millisecond)
+	start := time.Now()
+	client.Get(ctx, "key")
+	assert.True(time.Since(start) >= 20*time.Millisecond)
+
+	s.FlushAll()
+	assert.Equal(redis.Nil, client.Get(ctx, "key").Err())
+}
+
+func TestRESP3(t *testing.T) {
+	assert := assert.New(t)
+	s := StartServer(t)
+	nc, err := net.Dial("tcp", s.Addr())
+	assert.Nil(err)
+	defer nc.Close()
+	r := bufio.NewReader(nc)
+
+	// reply returns the raw reply to a command, which must fit in one read
+	reply := func(cmd string) string {
+		_, err := nc.Write([]byte(cmd))
+		assert.Nil(err)
+		time.Sleep(10 * time.Millisecond)
+		b := make([]byte, 4096)
+		n, err := r.Read(b)
+		assert.Nil(err)
+		return string(b[:n])
+	}
+
+	assert.Equal("$-1\r\n", reply("GET missing\r\n"))
+	assert.Contains(reply("*2\r\n$5\r\nHELLO\r\n$1\r\n3\r\n"), "%7\r\n$6\r\nserver\r\n$5\r\nredis\r\n")
+	assert.Equal("_\r\n", reply("GET missing\r\n"))
+	assert.Equal(":1\r\n", reply("HSET h f v\r\n"))
+	assert.Equal("%1\r\n$1\r\nf\r\n$1\r\nv\r\n", reply("HGETALL h\r\n"))
+	assert.Equal(">3\r\n$9\r\nsubscribe\r\n$2\r\nch\r\n:1\r\n", reply("SUBSCRIBE ch\r\n"))
+	// RESP3 connections may run any command while subscribed
+	assert.Equal("+PONG\r\n", reply("PING\r\n"))
+	assert.Equal("-NOPROTO unsupported protocol version\r\n", reply("HELLO 4\r\n"))
+}
+
+func TestMatch(t *testing.T) {
+	for _, tt := range []struct {
+		pattern, s string
+		match      bool
+	}{
+		{"*", "", true},
+		{"news.*", "news.tech", true},
+		{"news.*", "sports", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"a*b*c", "axxbyyc", true},
+		{"a[", "a[", true},
+	} {
+		assert.Equal(t, tt.match, match(tt.pattern, tt.s), "%s %s", tt.pattern, tt.s)
+	}
+}
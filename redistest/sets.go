@@ -0,0 +1,208 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redistest
+
+import (
+	"sort"
+	"strconv"
+)
+
+// set is the value of a set.
+type set map[string]struct{}
+
+// zset is the value of a sorted set, mapping its members to their scores.
+type zset map[string]float64
+
+func (c *conn) set(key string, create bool) (set, bool) {
+	it, ok := c.lookupKind(key, kindSet)
+	if !ok {
+		return nil, false
+	}
+	if it == nil {
+		if !create {
+			return nil, true
+		}
+		it = &item{value: make(set)}
+		c.keys()[key] = it
+	}
+	return it.value.(set), true
+}
+
+// sortedMembers returns the members of s in lexicographical order.
+func (s set) sortedMembers() []string {
+	members := make([]string, 0, len(s))
+	for m := range s {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+	return members
+}
+
+func (c *conn) cmdSAdd(args []string) {
+	s, ok := c.set(args[0], true)
+	if !ok {
+		return
+	}
+	var n int64
+	for _, m := range args[1:] {
+		if _, ok := s[m]; !ok {
+			s[m] = struct{}{}
+			n++
+		}
+	}
+	c.w.int(n)
+}
+
+func (c *conn) cmdSCard(args []string) {
+	s, ok := c.set(args[0], false)
+	if !ok {
+		return
+	}
+	c.w.int(int64(len(s)))
+}
+
+func (c *conn) cmdSIsMember(args []string) {
+	s, ok := c.set(args[0], false)
+	if !ok {
+		return
+	}
+	if _, ok := s[args[1]]; ok {
+		c.w.int(1)
+		return
+	}
+	c.w.int(0)
+}
+
+func (c *conn) cmdSMembers(args []string) {
+	s, ok := c.set(args[0], false)
+	if !ok {
+		return
+	}
+	c.w.bulks(s.sortedMembers())
+}
+
+func (c *conn) cmdSRem(args []string) {
+	s, ok := c.set(args[0], false)
+	if !ok {
+		return
+	}
+	var n int64
+	for _, m := range args[1:] {
+		if _, ok := s[m]; ok {
+			delete(s, m)
+			n++
+		}
+	}
+	if s != nil && len(s) == 0 {
+		delete(c.keys(), args[0])
+	}
+	c.w.int(n)
+}
+
+func (c *conn) zset(key string, create bool) (zset, bool) {
+	it, ok := c.lookupKind(key, kindZSet)
+	if !ok {
+		return nil, false
+	}
+	if it == nil {
+		if !create {
+			return nil, true
+		}
+		it = &item{value: make(zset)}
+		c.keys()[key] = it
+	}
+	return it.value.(zset), true
+}
+
+// sortedMembers returns the members of z ordered by score, then
+// lexicographically.
+func (z zset) sortedMembers() []string {
+	members := make([]string, 0, len(z))
+	for m := range z {
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		si, sj := z[members[i]], z[members[j]]
+		if si != sj {
+			return si < sj
+		}
+		return members[i] < members[j]
+	})
+	return members
+}
+
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+// cmdZAdd implements ZADD without its options.
+func (c *conn) cmdZAdd(args []string) {
+	if len(args)%2 != 1 {
+		c.w.err(errSyntax)
+		return
+	}
+	scores := make([]float64, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		score, err := strconv.ParseFloat(args[i], 64)
+		if err != nil {
+			c.w.err(errNotFloat)
+			return
+		}
+		scores = append(scores, score)
+	}
+	z, ok := c.zset(args[0], true)
+	if !ok {
+		return
+	}
+	var n int64
+	for i, score := range scores {
+		m := args[2+2*i]
+		if _, ok := z[m]; !ok {
+			n++
+		}
+		z[m] = score
+	}
+	c.w.int(n)
+}
+
+func (c *conn) cmdZCard(args []string) {
+	z, ok := c.zset(args[0], false)
+	if !ok {
+		return
+	}
+	c.w.int(int64(len(z)))
+}
+
+func (c *conn) cmdZRem(args []string) {
+	z, ok := c.zset(args[0], false)
+	if !ok {
+		return
+	}
+	var n int64
+	for _, m := range args[1:] {
+		if _, ok := z[m]; ok {
+			delete(z, m)
+			n++
+		}
+	}
+	if z != nil && len(z) == 0 {
+		delete(c.keys(), args[0])
+	}
+	c.w.int(n)
+}
+
+func (c *conn) cmdZScore(args []string) {
+	z, ok := c.zset(args[0], false)
+	if !ok {
+		return
+	}
+	score, ok := z[args[1]]
+	if !ok {
+		c.w.null()
+		return
+	}
+	c.w.bulk(formatScore(score))
+}
@@ -0,0 +1,187 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redistest
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+)
+
+type expectations struct {
+	operationName string
+	checks        []func(span mocktracer.Span) string
+}
+
+// Expectation is a property expected from a span by AssertCommandSpan and
+// AssertPipelineSpan.
+type Expectation func(*expectations)
+
+// OperationName expects the span to have the given operation name instead
+// of "redis.command".
+func OperationName(name string) Expectation {
+	return func(e *expectations) {
+		e.operationName = name
+	}
+}
+
+// Tag expects the span to have the given tag.
+func Tag(key string, value interface{}) Expectation {
+	return func(e *expectations) {
+		e.checks = append(e.checks, func(span mocktracer.Span) string {
+			return checkTag(span, key, value)
+		})
+	}
+}
+
+// NoTag expects the span not to have the given tag.
+func NoTag(key string) Expectation {
+	return func(e *expectations) {
+		e.checks = append(e.checks, func(span mocktracer.Span) string {
+			if v := span.Tag(key); v != nil {
+				return fmt.Sprintf("tag %s: got %v, want none", key, v)
+			}
+			return ""
+		})
+	}
+}
+
+// ServiceName expects the span to have the given service name.
+func ServiceName(name string) Expectation {
+	return Tag(ext.ServiceName, name)
+}
+
+// ChildOf expects the span to be a child of parent.
+func ChildOf(parent mocktracer.Span) Expectation {
+	return func(e *expectations) {
+		e.checks = append(e.checks, func(span mocktracer.Span) string {
+			if span.ParentID() != parent.SpanID() {
+				return fmt.Sprintf("parent: got %d, want %d", span.ParentID(), parent.SpanID())
+			}
+			return ""
+		})
+	}
+}
+
+// Error expects the span to be marked as an error, or not.
+func Error(on bool) Expectation {
+	return func(e *expectations) {
+		e.checks = append(e.checks, func(span mocktracer.Span) string {
+			if err := span.Tag(ext.Error); (err != nil) != on {
+				return fmt.Sprintf("error: got %v, want %t", err, on)
+			}
+			return ""
+		})
+	}
+}
+
+func checkTag(span mocktracer.Span, key string, want interface{}) string {
+	if got := span.Tag(key); !reflect.DeepEqual(got, want) {
+		return fmt.Sprintf("tag %s: got %#v, want %#v", key, got, want)
+	}
+	return ""
+}
+
+// checkClientSpan returns the differences between span and the standard
+// tags of the Redis client spans and the given expectations.
+func checkClientSpan(span mocktracer.Span, exps []Expectation) []string {
+	e := &expectations{operationName: "redis.command"}
+	for _, exp := range exps {
+		exp(e)
+	}
+	var diffs []string
+	if got := span.OperationName(); got != e.operationName {
+		diffs = append(diffs, fmt.Sprintf("operation name: got %q, want %q", got, e.operationName))
+	}
+	for _, check := range []string{
+		checkTag(span, ext.SpanType, ext.SpanTypeRedis),
+		checkTag(span, "span.kind", "client"),
+		checkTag(span, "db.system", "redis"),
+	} {
+		if check != "" {
+			diffs = append(diffs, check)
+		}
+	}
+	if component, _ := span.Tag("component").(string); !strings.HasPrefix(component, "go-redis/redis") {
+		diffs = append(diffs, fmt.Sprintf("tag component: got %q, want go-redis/redis.*", component))
+	}
+	for _, check := range e.checks {
+		if diff := check(span); diff != "" {
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs
+}
+
+// AssertCommandSpan asserts that span is the span of the given command, such
+// as "get", with the standard tags of the Redis client spans and the given
+// expectations. It reports whether the assertion succeeded.
+func AssertCommandSpan(t testing.TB, span mocktracer.Span, command string, exps ...Expectation) bool {
+	t.Helper()
+	diffs := checkClientSpan(span, exps)
+	if got, _ := span.Tag(ext.ResourceName).(string); !hasCommandPrefix(got, command) {
+		diffs = append(diffs, fmt.Sprintf("resource: got %q, want %q", got, command))
+	}
+	if raw, ok := span.Tag("redis.raw_command").(string); ok && !hasCommandPrefix(raw, command) {
+		diffs = append(diffs, fmt.Sprintf("tag redis.raw_command: got %q, want %s command", raw, command))
+	}
+	if n := span.Tag("redis.pipeline_length"); n != nil {
+		diffs = append(diffs, fmt.Sprintf("tag redis.pipeline_length: got %v, want none", n))
+	}
+	return report(t, span, diffs)
+}
+
+// AssertPipelineSpan asserts that span is the span of a pipeline of the given
+// commands, with the standard tags of the Redis client spans and the given
+// expectations. It reports whether the assertion succeeded.
+func AssertPipelineSpan(t testing.TB, span mocktracer.Span, commands []string, exps ...Expectation) bool {
+	t.Helper()
+	diffs := checkClientSpan(span, exps)
+	if diff := checkTag(span, "redis.pipeline_length", strconv.Itoa(len(commands))); diff != "" {
+		diffs = append(diffs, diff)
+	}
+	resource, _ := span.Tag(ext.ResourceName).(string)
+	lines := strings.Split(strings.TrimSuffix(resource, "\n"), "\n")
+	// the resource may be truncated by WithMaxRawCommandLength
+	truncated := strings.HasSuffix(resource, "...")
+	if len(lines) > len(commands) || (len(lines) < len(commands) && !truncated) {
+		diffs = append(diffs, fmt.Sprintf("resource: got %d commands, want %d", len(lines), len(commands)))
+	} else {
+		for i, line := range lines {
+			if truncated && i == len(lines)-1 {
+				break
+			}
+			if !hasCommandPrefix(line, commands[i]) {
+				diffs = append(diffs, fmt.Sprintf("resource: got %q, want %s command", line, commands[i]))
+			}
+		}
+	}
+	return report(t, span, diffs)
+}
+
+// hasCommandPrefix reports whether the formatted command s is the given
+// command.
+func hasCommandPrefix(s, command string) bool {
+	name := s
+	if i := strings.IndexAny(s, " :"); i >= 0 {
+		name = s[:i]
+	}
+	return strings.EqualFold(name, command)
+}
+
+func report(t testing.TB, span mocktracer.Span, diffs []string) bool {
+	t.Helper()
+	if len(diffs) == 0 {
+		return true
+	}
+	t.Errorf("unexpected span %s:\n\t%s", span.OperationName(), strings.Join(diffs, "\n\t"))
+	return false
+}
@@ -0,0 +1,109 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redistest_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/johejo/dd-trace-go-redis/redistest"
+	redistrace "github.com/johejo/dd-trace-go-redis/v8"
+)
+
+// recorder records the errors of failed assertions.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+// traceCommands runs a GET and a pipeline within a parent span.
+func traceCommands(t *testing.T, mt mocktracer.Tracer) []mocktracer.Span {
+	s := redistest.StartServer(t)
+	client := redistrace.NewClient(&redis.Options{Addr: s.Addr()}, redistrace.WithServiceName("my-redis"))
+	defer client.Close()
+
+	root, ctx := tracer.StartSpanFromContext(context.Background(), "parent.span")
+	client.Set(ctx, "key", "value", 0)
+	pipeline := client.Pipeline()
+	pipeline.Get(ctx, "key")
+	pipeline.Expire(ctx, "key", time.Hour)
+	_, err := pipeline.Exec(ctx)
+	assert.Nil(t, err)
+	root.Finish()
+	return mt.FinishedSpans()
+}
+
+func TestAssertSpans(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+	spans := traceCommands(t, mt)
+	assert.Len(t, spans, 3)
+	set, pipeline, root := spans[0], spans[1], spans[2]
+
+	redistest.AssertCommandSpan(t, set, "set",
+		redistest.ServiceName("my-redis"),
+		redistest.Tag("redis.raw_command", "set key value: "),
+		redistest.ChildOf(root),
+		redistest.Error(false),
+	)
+	redistest.AssertPipelineSpan(t, pipeline, []string{"get", "expire"}, redistest.ChildOf(root))
+	redistest.AssertSpanTree(t, spans, redistest.Tree{
+		Operation: "parent.span",
+		Children: []redistest.Tree{
+			{Operation: "redis.command", Resource: "set"},
+			{Operation: "redis.command"},
+		},
+	})
+
+	r := &recorder{TB: t}
+	assert.False(t, redistest.AssertCommandSpan(r, set, "get",
+		redistest.OperationName("redis.set"),
+		redistest.NoTag(ext.ServiceName),
+	))
+	assert.False(t, redistest.AssertCommandSpan(r, pipeline, "get"))
+	assert.False(t, redistest.AssertPipelineSpan(r, pipeline, []string{"get"}))
+	assert.False(t, redistest.AssertCommandSpan(r, root, "get"))
+	assert.False(t, redistest.AssertSpanTree(r, spans, redistest.Tree{Operation: "parent.span"}))
+	assert.Len(t, r.errors, 5)
+	assert.Contains(t, r.errors[0], `resource: got "set", want "get"`)
+	assert.Contains(t, r.errors[0], `operation name: got "redis.command", want "redis.set"`)
+	assert.Contains(t, r.errors[0], "tag service.name: got my-redis, want none")
+	assert.Contains(t, r.errors[1], "tag redis.pipeline_length")
+	assert.Contains(t, r.errors[2], "resource: got 2 commands, want 1")
+	assert.Contains(t, r.errors[3], "tag span.type")
+	assert.Contains(t, r.errors[4], "/parent.span/: got 2 spans, want 0")
+}
+
+func TestAssertGolden(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+	spans := traceCommands(t, mt)
+
+	redistest.AssertGolden(t, spans, "testdata/commands.golden")
+	if os.Getenv(redistest.UpdateGoldenEnv) != "" {
+		return
+	}
+
+	r := &recorder{TB: t}
+	assert.False(t, redistest.AssertGolden(r, spans[:1], "testdata/commands.golden"))
+	assert.False(t, redistest.AssertGolden(r, spans, "testdata/missing.golden"))
+	assert.Len(t, r.errors, 2)
+}
@@ -0,0 +1,350 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redistest
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const errInvalidStreamID = "ERR Invalid stream ID specified as stream command argument"
+
+type streamID struct {
+	ms, seq uint64
+}
+
+func (id streamID) String() string {
+	return strconv.FormatUint(id.ms, 10) + "-" + strconv.FormatUint(id.seq, 10)
+}
+
+func (id streamID) less(other streamID) bool {
+	return id.ms < other.ms || (id.ms == other.ms && id.seq < other.seq)
+}
+
+// parseStreamID parses an ID of the form "ms-seq" or "ms", in which case the
+// sequence number is seq.
+func parseStreamID(s string, seq uint64) (streamID, error) {
+	msPart, seqPart := s, ""
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		msPart, seqPart = s[:i], s[i+1:]
+	}
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return streamID{}, err
+	}
+	if seqPart != "" {
+		if seq, err = strconv.ParseUint(seqPart, 10, 64); err != nil {
+			return streamID{}, err
+		}
+	} else if strings.HasSuffix(s, "-") {
+		return streamID{}, errors.New("missing sequence number")
+	}
+	return streamID{ms, seq}, nil
+}
+
+type streamEntry struct {
+	id     streamID
+	fields []string
+}
+
+type stream struct {
+	entries []streamEntry
+	last    streamID
+}
+
+// nextID returns the ID of an entry added with the given ID argument of XADD,
+// which is "*", "ms-*" or an explicit ID.
+func (s *stream) nextID(arg string) (streamID, string) {
+	if arg == "*" {
+		ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+		if ms <= s.last.ms {
+			return streamID{s.last.ms, s.last.seq + 1}, ""
+		}
+		return streamID{ms, 0}, ""
+	}
+	var (
+		id  streamID
+		err error
+	)
+	if strings.HasSuffix(arg, "-*") {
+		id, err = parseStreamID(strings.TrimSuffix(arg, "-*"), 0)
+		if err == nil && id.ms == s.last.ms && (s.last != streamID{}) {
+			id.seq = s.last.seq + 1
+		}
+	} else {
+		id, err = parseStreamID(arg, 0)
+	}
+	switch {
+	case err != nil:
+		return id, errInvalidStreamID
+	case id == streamID{}:
+		return id, "ERR The ID specified in XADD must be greater than 0-0"
+	case !s.last.less(id):
+		return id, "ERR The ID specified in XADD is equal or smaller than the target stream top item"
+	}
+	return id, ""
+}
+
+// after returns the entries of s whose ID is greater than id, at most count
+// if count is positive.
+func (s *stream) after(id streamID, count int) []streamEntry {
+	var entries []streamEntry
+	for _, e := range s.entries {
+		if id.less(e.id) {
+			entries = append(entries, e)
+			if count > 0 && len(entries) == count {
+				break
+			}
+		}
+	}
+	return entries
+}
+
+func (w *writer) entries(entries []streamEntry) {
+	w.array(len(entries))
+	for _, e := range entries {
+		w.array(2)
+		w.bulk(e.id.String())
+		w.bulks(e.fields)
+	}
+}
+
+func (c *conn) stream(key string) (*stream, bool) {
+	it, ok := c.lookupKind(key, kindStream)
+	if !ok || it == nil {
+		return nil, ok
+	}
+	return it.value.(*stream), true
+}
+
+func (c *conn) cmdXAdd(args []string) {
+	key := args[0]
+	noMkStream := false
+	maxLen := -1
+	i := 1
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "nomkstream":
+			noMkStream = true
+		case "maxlen":
+			i++
+			if i < len(args) && (args[i] == "=" || args[i] == "~") {
+				i++
+			}
+			if i == len(args) {
+				c.w.err(errSyntax)
+				return
+			}
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 0 {
+				c.w.err("ERR The MAXLEN argument must be >= 0.")
+				return
+			}
+			maxLen = n
+		default:
+			break options
+		}
+	}
+	if i == len(args) || (len(args)-i-1) == 0 || (len(args)-i-1)%2 != 0 {
+		c.w.err("ERR wrong number of arguments for 'xadd' command")
+		return
+	}
+	s, ok := c.stream(key)
+	if !ok {
+		return
+	}
+	if s == nil {
+		if noMkStream {
+			c.w.null()
+			return
+		}
+		s = new(stream)
+	}
+	id, msg := s.nextID(args[i])
+	if msg != "" {
+		c.w.err(msg)
+		return
+	}
+	if c.lookup(key) == nil {
+		c.keys()[key] = &item{value: s}
+	}
+	fields := append([]string(nil), args[i+1:]...)
+	s.entries = append(s.entries, streamEntry{id: id, fields: fields})
+	s.last = id
+	if maxLen >= 0 && len(s.entries) > maxLen {
+		s.entries = s.entries[len(s.entries)-maxLen:]
+	}
+	c.s.notify()
+	c.w.bulk(id.String())
+}
+
+func (c *conn) cmdXLen(args []string) {
+	s, ok := c.stream(args[0])
+	if !ok {
+		return
+	}
+	if s == nil {
+		c.w.int(0)
+		return
+	}
+	c.w.int(int64(len(s.entries)))
+}
+
+func (c *conn) cmdXRange(args []string) {
+	start, end := streamID{}, streamID{math.MaxUint64, math.MaxUint64}
+	var err error
+	if args[1] != "-" {
+		if start, err = parseStreamID(args[1], 0); err != nil {
+			c.w.err(errInvalidStreamID)
+			return
+		}
+	}
+	if args[2] != "+" {
+		if end, err = parseStreamID(args[2], math.MaxUint64); err != nil {
+			c.w.err(errInvalidStreamID)
+			return
+		}
+	}
+	count := 0
+	if len(args) > 3 {
+		if len(args) != 5 || strings.ToLower(args[3]) != "count" {
+			c.w.err(errSyntax)
+			return
+		}
+		n, ok := parseInt(args[4])
+		if !ok {
+			c.w.err(errNotInteger)
+			return
+		}
+		if n <= 0 {
+			c.w.array(0)
+			return
+		}
+		count = int(n)
+	}
+	s, ok := c.stream(args[0])
+	if !ok {
+		return
+	}
+	var entries []streamEntry
+	if s != nil {
+		for _, e := range s.entries {
+			if e.id.less(start) || end.less(e.id) {
+				continue
+			}
+			entries = append(entries, e)
+			if count > 0 && len(entries) == count {
+				break
+			}
+		}
+	}
+	c.w.entries(entries)
+}
+
+func (c *conn) cmdXRead(args []string) {
+	count := 0
+	block := false
+	var deadline time.Time
+	i := 0
+	for ; i < len(args) && strings.ToLower(args[i]) != "streams"; i++ {
+		switch strings.ToLower(args[i]) {
+		case "count", "block":
+			if i+1 == len(args) {
+				c.w.err(errSyntax)
+				return
+			}
+			n, ok := parseInt(args[i+1])
+			if !ok || n < 0 {
+				c.w.err(errNotInteger)
+				return
+			}
+			if strings.ToLower(args[i]) == "count" {
+				count = int(n)
+			} else {
+				block = true
+				if n > 0 {
+					deadline = time.Now().Add(time.Duration(n) * time.Millisecond)
+				}
+			}
+			i++
+		default:
+			c.w.err(errSyntax)
+			return
+		}
+	}
+	if i == len(args) {
+		c.w.err(errSyntax)
+		return
+	}
+	rest := args[i+1:]
+	if len(rest) == 0 || len(rest)%2 != 0 {
+		c.w.err("ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.")
+		return
+	}
+	keys, ids := rest[:len(rest)/2], rest[len(rest)/2:]
+	from := make([]streamID, len(keys))
+	for j, key := range keys {
+		s, ok := c.stream(key)
+		if !ok {
+			return
+		}
+		if ids[j] == "$" {
+			if s != nil {
+				from[j] = s.last
+			}
+			continue
+		}
+		id, err := parseStreamID(ids[j], 0)
+		if err != nil {
+			c.w.err(errInvalidStreamID)
+			return
+		}
+		from[j] = id
+	}
+	for {
+		var (
+			found   []string
+			entries [][]streamEntry
+		)
+		for j, key := range keys {
+			s, ok := c.stream(key)
+			if !ok {
+				return
+			}
+			if s == nil {
+				continue
+			}
+			if e := s.after(from[j], count); len(e) > 0 {
+				found = append(found, key)
+				entries = append(entries, e)
+			}
+		}
+		if len(found) > 0 {
+			if c.w.proto == 3 {
+				c.w.mapHeader(len(found))
+			} else {
+				c.w.array(len(found))
+			}
+			for j, key := range found {
+				if c.w.proto != 3 {
+					c.w.array(2)
+				}
+				c.w.bulk(key)
+				c.w.entries(entries[j])
+			}
+			return
+		}
+		// blocking commands do not block within transactions
+		if !block || c.inExec || !c.s.wait(deadline) {
+			c.w.nullArray()
+			return
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redistest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+)
+
+// Tree is the expected shape of a tree of spans.
+type Tree struct {
+	// Operation is the operation name of the span.
+	Operation string
+	// Resource is the resource name of the span. It is not checked if empty.
+	Resource string
+	// Children are the children of the span, in the order they started.
+	Children []Tree
+}
+
+// spanTree indexes the spans by parent.
+type spanTree struct {
+	roots    []mocktracer.Span
+	children map[uint64][]mocktracer.Span
+}
+
+// newSpanTree returns the trees formed by spans. Spans whose parent is not
+// one of spans are roots. Siblings are ordered by start time.
+func newSpanTree(spans []mocktracer.Span) *spanTree {
+	ids := make(map[uint64]bool, len(spans))
+	for _, s := range spans {
+		ids[s.SpanID()] = true
+	}
+	sorted := append([]mocktracer.Span(nil), spans...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].StartTime().Before(sorted[j].StartTime())
+	})
+	t := &spanTree{children: make(map[uint64][]mocktracer.Span)}
+	for _, s := range sorted {
+		if ids[s.ParentID()] {
+			t.children[s.ParentID()] = append(t.children[s.ParentID()], s)
+		} else {
+			t.roots = append(t.roots, s)
+		}
+	}
+	return t
+}
+
+// AssertSpanTree asserts that spans form the given trees, ordered by start
+// time. It reports whether the assertion succeeded.
+func AssertSpanTree(t testing.TB, spans []mocktracer.Span, want ...Tree) bool {
+	t.Helper()
+	tree := newSpanTree(spans)
+	if diff := tree.match("", tree.roots, want); diff != "" {
+		t.Errorf("unexpected span tree: %s\n%s", diff, tree.format(nil))
+		return false
+	}
+	return true
+}
+
+func (t *spanTree) match(path string, spans []mocktracer.Span, want []Tree) string {
+	if len(spans) != len(want) {
+		return fmt.Sprintf("%s/: got %d spans, want %d", path, len(spans), len(want))
+	}
+	for i, s := range spans {
+		w := want[i]
+		if got := s.OperationName(); got != w.Operation {
+			return fmt.Sprintf("%s/%d: got operation %q, want %q", path, i, got, w.Operation)
+		}
+		if got := s.Tag(ext.ResourceName); w.Resource != "" && got != w.Resource {
+			return fmt.Sprintf("%s/%s: got resource %q, want %q", path, w.Operation, got, w.Resource)
+		}
+		if diff := t.match(path+"/"+w.Operation, t.children[s.SpanID()], w.Children); diff != "" {
+			return diff
+		}
+	}
+	return ""
+}
+
+// format writes the trees, with the tags of the spans if tags is not nil.
+func (t *spanTree) format(tags func(mocktracer.Span) []string) string {
+	var b strings.Builder
+	var walk func(spans []mocktracer.Span, indent string)
+	walk = func(spans []mocktracer.Span, indent string) {
+		for _, s := range spans {
+			b.WriteString(indent + "- " + s.OperationName())
+			if tags == nil {
+				fmt.Fprintf(&b, " %q", s.Tag(ext.ResourceName))
+			}
+			b.WriteString("\n")
+			if tags != nil {
+				for _, tag := range tags(s) {
+					b.WriteString(indent + "    " + tag + "\n")
+				}
+			}
+			walk(t.children[s.SpanID()], indent+"  ")
+		}
+	}
+	walk(t.roots, "")
+	return b.String()
+}
+
+// VolatileTags are the tags whose values change across runs, which Snapshot
+// leaves out.
+var VolatileTags = []string{
+	ext.TargetPort,
+	"redis.deadline_remaining_ms",
+	"redis.stream.message_id",
+}
+
+// Snapshot returns a text representation of the trees formed by spans and of
+// their tags, which is stable across runs: IDs, timings, VolatileTags and the
+// given tags are left out.
+func Snapshot(spans []mocktracer.Span, ignoredTags ...string) string {
+	ignored := make(map[string]bool)
+	for _, tag := range VolatileTags {
+		ignored[tag] = true
+	}
+	for _, tag := range ignoredTags {
+		ignored[tag] = true
+	}
+	return newSpanTree(spans).format(func(s mocktracer.Span) []string {
+		var tags []string
+		for k, v := range s.Tags() {
+			if !ignored[k] {
+				tags = append(tags, k+": "+formatTag(v))
+			}
+		}
+		sort.Strings(tags)
+		return tags
+	})
+}
+
+// formatTag formats the value of a tag on a single line.
+func formatTag(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case error:
+		return strconv.Quote(v.Error())
+	}
+	return fmt.Sprint(v)
+}
+
+// UpdateGoldenEnv is the environment variable which, when set to a non-empty
+// value, makes AssertGolden write the golden files instead of comparing them.
+const UpdateGoldenEnv = "REDISTEST_UPDATE_GOLDEN"
+
+// AssertGolden asserts that the Snapshot of spans, leaving out ignoredTags, is
+// the content of the golden file at path. It reports whether the assertion
+// succeeded.
+func AssertGolden(t testing.TB, spans []mocktracer.Span, path string, ignoredTags ...string) bool {
+	t.Helper()
+	got := Snapshot(spans, ignoredTags...)
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Errorf("redistest: %v", err)
+			return false
+		}
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Errorf("redistest: %v", err)
+			return false
+		}
+		return true
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Errorf("redistest: %v (set %s=1 to create it)", err, UpdateGoldenEnv)
+		return false
+	}
+	if got != string(want) {
+		t.Errorf("spans do not match %s (set %s=1 to update it):\ngot:\n%s\nwant:\n%s", path, UpdateGoldenEnv, got, want)
+		return false
+	}
+	return true
+}
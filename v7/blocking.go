@@ -0,0 +1,73 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+// blockingTimeout returns the timeout requested by a blocking command, where
+// 0 means blocking indefinitely. It returns false if cmd does not block.
+func blockingTimeout(cmd redis.Cmder) (time.Duration, bool) {
+	args := cmd.Args()
+	switch cmd.Name() {
+	case "blpop", "brpop", "brpoplpush", "blmove", "bzpopmin", "bzpopmax":
+		return parseTimeout(args[len(args)-1], time.Second)
+	case "blmpop", "bzmpop":
+		if len(args) < 2 {
+			return 0, false
+		}
+		return parseTimeout(args[1], time.Second)
+	case "wait":
+		if len(args) < 3 {
+			return 0, false
+		}
+		return parseTimeout(args[2], time.Millisecond)
+	case "xread", "xreadgroup":
+		for i := 1; i < len(args)-1; i++ {
+			switch strings.ToLower(fmt.Sprint(args[i])) {
+			case "block":
+				return parseTimeout(args[i+1], time.Millisecond)
+			case "streams":
+				return 0, false
+			}
+		}
+	}
+	return 0, false
+}
+
+// parseTimeout parses a timeout argument expressed in the given unit.
+func parseTimeout(arg interface{}, unit time.Duration) (time.Duration, bool) {
+	f, err := strconv.ParseFloat(fmt.Sprint(arg), 64)
+	if err != nil || f < 0 {
+		return 0, false
+	}
+	return time.Duration(f * float64(unit)), true
+}
+
+// blockingTimedOut reports whether a blocking command returned because its
+// timeout expired.
+func blockingTimedOut(cmd redis.Cmder) bool {
+	if cmd.Err() == redis.Nil {
+		return true
+	}
+	if cmd.Name() != "wait" {
+		return false
+	}
+	// WAIT returns the number of replicas reached, which is lower than the
+	// requested number when the timeout expires.
+	c, ok := cmd.(*redis.IntCmd)
+	if !ok || c.Err() != nil {
+		return false
+	}
+	want, err := strconv.ParseInt(fmt.Sprint(cmd.Args()[1]), 10, 64)
+	return err == nil && c.Val() < want
+}
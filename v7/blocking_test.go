@@ -0,0 +1,74 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+)
+
+func TestBlocking(t *testing.T) {
+	opts := &redis.Options{Addr: testServer.Addr()}
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	client := NewClient(opts, WithServiceName("my-redis"), WithBlockingOperationName("redis.command.blocking"))
+	client.Del("blocking_list")
+	client.RPush("blocking_list", "a")
+	mt.Reset()
+
+	_, err := client.BLPop(time.Second, "blocking_list").Result()
+	assert.Nil(err)
+	_, err = client.BLPop(time.Second, "blocking_list").Result()
+	assert.Equal(redis.Nil, err)
+	client.Get("test_key")
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 3)
+	for _, s := range spans[:2] {
+		assert.Equal("redis.command.blocking", s.OperationName())
+		assert.Equal(true, s.Tag("redis.blocking"))
+		assert.Equal(int64(1000), s.Tag("redis.blocking.timeout_ms"))
+	}
+	assert.Equal(false, spans[0].Tag("redis.blocking.timed_out"))
+	assert.Equal(true, spans[1].Tag("redis.blocking.timed_out"))
+	assert.Equal("redis.command", spans[2].OperationName())
+	assert.Nil(spans[2].Tag("redis.blocking"))
+}
+
+func TestBlockingTimeout(t *testing.T) {
+	for _, tt := range []struct {
+		cmd      redis.Cmder
+		timeout  time.Duration
+		blocking bool
+	}{
+		{redis.NewStringSliceCmd("blpop", "a", "b", 2), 2 * time.Second, true},
+		{redis.NewStringCmd("brpoplpush", "a", "b", 0), 0, true},
+		{redis.NewZWithKeyCmd("bzpopmin", "a", "1.5"), 1500 * time.Millisecond, true},
+		{redis.NewStringSliceCmd("blmpop", 3, 1, "a", "left"), 3 * time.Second, true},
+		{redis.NewIntCmd("wait", 1, 100), 100 * time.Millisecond, true},
+		{redis.NewXStreamSliceCmd("xread", "count", 1, "block", 50, "streams", "s", "0"), 50 * time.Millisecond, true},
+		{redis.NewXStreamSliceCmd("xreadgroup", "group", "g", "c", "streams", "block", "0"), 0, false},
+		{redis.NewStringCmd("get", "block"), 0, false},
+	} {
+		timeout, blocking := blockingTimeout(tt.cmd)
+		assert.Equal(t, tt.blocking, blocking, tt.cmd.String())
+		assert.Equal(t, tt.timeout, timeout, tt.cmd.String())
+	}
+}
+
+func TestBlockingTimedOut(t *testing.T) {
+	assert := assert.New(t)
+
+	cmd := redis.NewStringSliceCmd("blpop", "a", 1)
+	cmd.SetErr(redis.Nil)
+	assert.True(blockingTimedOut(cmd))
+}
@@ -0,0 +1,83 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+func TestContextWithSpanOptions(t *testing.T) {
+	opts := &redis.Options{Addr: testServer.Addr()}
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	client := NewClient(opts, WithServiceName("my-redis"))
+	ctx := ContextWithSpanOptions(context.Background(), tracer.Tag("tenant", "acme"))
+	ctx = ContextWithSpanOptions(ctx, tracer.ServiceName("my-cache"))
+	client.WithContext(ctx).Get("test_key")
+	pipeline := client.Pipeline()
+	pipeline.Expire("pipeline_counter", time.Hour)
+	_, err := pipeline.ExecContext(ctx)
+	assert.Nil(err)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 2)
+	for _, s := range spans {
+		assert.Equal("acme", s.Tag("tenant"))
+		assert.Equal("my-cache", s.Tag(ext.ServiceName))
+	}
+
+	// the options of the context take precedence over the tags of the command
+	mt.Reset()
+	client.WithContext(ContextWithSpanOptions(ctx, tracer.ResourceName("get_user"))).Get("test_key")
+	spans = mt.FinishedSpans()
+	assert.Len(spans, 1)
+	assert.Equal("get_user", spans[0].Tag(ext.ResourceName))
+	assert.Equal("2", spans[0].Tag("redis.args_length"))
+}
+
+func TestContextWithSkipTracing(t *testing.T) {
+	opts := &redis.Options{Addr: testServer.Addr()}
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	client := NewClient(opts, WithServiceName("my-redis"))
+	root, ctx := tracer.StartSpanFromContext(context.Background(), "parent.span")
+	skipped := ContextWithSkipTracing(ctx)
+	client.WithContext(skipped).Get("test_key")
+	pipeline := client.Pipeline()
+	pipeline.Expire("pipeline_counter", time.Hour)
+	_, err := pipeline.ExecContext(skipped)
+	assert.Nil(err)
+	skippedClient := client.WithContext(skipped)
+	NewScript("echo", "return ARGV[1]").Run(skippedClient, nil, "hello")
+	XAdd(skippedClient, &redis.XAddArgs{Stream: "test_stream", Values: map[string]interface{}{"a": "1"}})
+	Publish(skippedClient, "test_channel", "hello")
+	iter := Scan(skippedClient, 0, "", 0)
+	for iter.Next() {
+	}
+	span, _ := StartConsumeSpan(skipped, "test_stream", redis.XMessage{})
+	span.Finish()
+	assert.Len(mt.FinishedSpans(), 0)
+
+	client.WithContext(ctx).Get("test_key")
+	root.Finish()
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 2)
+	assert.Equal("redis.command", spans[0].OperationName())
+	assert.Equal("parent.span", spans[1].OperationName())
+}
@@ -0,0 +1,104 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/go-redis/redis/v7"
+)
+
+// Classes of errors which are not Redis error replies. Error replies are
+// classified by their prefix, such as "MOVED", "READONLY" or "WRONGTYPE".
+const (
+	// ErrorClassTimeout is the class of network timeouts.
+	ErrorClassTimeout = "timeout"
+	// ErrorClassPoolTimeout is the class of errors returned when no
+	// connection could be taken from the pool in time.
+	ErrorClassPoolTimeout = "pool_timeout"
+	// ErrorClassCanceled is the class of errors caused by a canceled context.
+	ErrorClassCanceled = "canceled"
+	// ErrorClassDeadlineExceeded is the class of errors caused by an expired
+	// context deadline.
+	ErrorClassDeadlineExceeded = "deadline_exceeded"
+	// ErrorClassClosed is the class of errors returned by a closed client.
+	ErrorClassClosed = "closed"
+	// ErrorClassNetwork is the class of other network errors.
+	ErrorClassNetwork = "network"
+	// ErrorClassReply is the class of Redis error replies without a prefix.
+	ErrorClassReply = "reply"
+)
+
+// poolTimeoutMessage is the message of the pool timeout error, which go-redis
+// does not export.
+const poolTimeoutMessage = "redis: connection pool timeout"
+
+// classifyError returns the class of err and, for Redis error replies, their
+// prefix. It returns an empty class if err is not recognized.
+func classifyError(err error) (class, prefix string) {
+	if err == nil || err == redis.Nil {
+		return "", ""
+	}
+	var replyErr redis.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ErrorClassCanceled, ""
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassDeadlineExceeded, ""
+	case errors.Is(err, redis.ErrClosed):
+		return ErrorClassClosed, ""
+	case err.Error() == poolTimeoutMessage:
+		return ErrorClassPoolTimeout, ""
+	case errors.As(err, &replyErr):
+		prefix = replyPrefix(replyErr.Error())
+		if prefix == "" {
+			return ErrorClassReply, ""
+		}
+		return prefix, prefix
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrorClassTimeout, ""
+		}
+		return ErrorClassNetwork, ""
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrorClassNetwork, ""
+	}
+	return "", ""
+}
+
+// replyPrefix returns the prefix of a Redis error reply, which by convention
+// is its first word in upper case.
+func replyPrefix(msg string) string {
+	if i := strings.IndexByte(msg, ' '); i >= 0 {
+		msg = msg[:i]
+	}
+	if msg == "" {
+		return ""
+	}
+	for _, r := range msg {
+		if (r < 'A' || r > 'Z') && r != '_' {
+			return ""
+		}
+	}
+	return msg
+}
+
+// isIgnoredError reports whether errors of the given class returned by the
+// named command should not mark spans as errors.
+func (cfg *clientConfig) isIgnoredError(command, class string) bool {
+	cmds, ok := cfg.ignoredErrors[class]
+	if !ok {
+		return false
+	}
+	return cmds == nil || cmds[command]
+}
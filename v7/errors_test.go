@@ -0,0 +1,127 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+)
+
+type replyError string
+
+func (e replyError) Error() string { return string(e) }
+
+func (replyError) RedisError() {}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyError(t *testing.T) {
+	for _, tt := range []struct {
+		err    error
+		class  string
+		prefix string
+	}{
+		{nil, "", ""},
+		{redis.Nil, "", ""},
+		{replyError("MOVED 3999 127.0.0.1:6381"), "MOVED", "MOVED"},
+		{replyError("BUSYGROUP Consumer Group name already exists"), "BUSYGROUP", "BUSYGROUP"},
+		{replyError("unknown error"), ErrorClassReply, ""},
+		{context.Canceled, ErrorClassCanceled, ""},
+		{fmt.Errorf("wrapped: %w", context.DeadlineExceeded), ErrorClassDeadlineExceeded, ""},
+		{redis.ErrClosed, ErrorClassClosed, ""},
+		{errors.New("redis: connection pool timeout"), ErrorClassPoolTimeout, ""},
+		{&net.OpError{Op: "read", Err: timeoutError{}}, ErrorClassTimeout, ""},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, ErrorClassNetwork, ""},
+		{io.EOF, ErrorClassNetwork, ""},
+		{errors.New("other"), "", ""},
+	} {
+		class, prefix := classifyError(tt.err)
+		assert.Equal(t, tt.class, class, "%v", tt.err)
+		assert.Equal(t, tt.prefix, prefix, "%v", tt.err)
+	}
+}
+
+func TestIgnoredErrorClass(t *testing.T) {
+	opts := &redis.Options{Addr: testServer.Addr()}
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	client := NewClient(opts, WithServiceName("my-redis"), WithIgnoredErrorClass("WRONGTYPE", "LPush"))
+	client.Set("test_key", "test_value", 0)
+	mt.Reset()
+
+	err := client.LPush("test_key", "a").Err()
+	assert.NotNil(err)
+	err = client.RPush("test_key", "a").Err()
+	assert.NotNil(err)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 2)
+	assert.Nil(spans[0].Tag(ext.Error))
+	assert.Equal("WRONGTYPE", spans[0].Tag(ext.ErrorType))
+	assert.Equal("WRONGTYPE", spans[0].Tag("redis.error_prefix"))
+	assert.Equal(err, spans[1].Tag(ext.Error))
+	assert.Equal("WRONGTYPE", spans[1].Tag(ext.ErrorType))
+}
+
+func TestIsIgnoredError(t *testing.T) {
+	assert := assert.New(t)
+	cfg := newClientConfig(
+		WithIgnoredErrorClass(ErrorClassCanceled),
+		WithIgnoredErrorClass("BUSYGROUP", "xgroup"),
+		WithIgnoredErrorClass(ErrorClassCanceled, "get"),
+	)
+	assert.True(cfg.isIgnoredError("get", ErrorClassCanceled))
+	assert.True(cfg.isIgnoredError("set", ErrorClassCanceled))
+	assert.True(cfg.isIgnoredError("xgroup", "BUSYGROUP"))
+	assert.False(cfg.isIgnoredError("xadd", "BUSYGROUP"))
+	assert.False(cfg.isIgnoredError("get", "WRONGTYPE"))
+}
+
+func TestErrorCheck(t *testing.T) {
+	opts := &redis.Options{Addr: testServer.Addr()}
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	var checked []string
+	client := NewClient(opts, WithServiceName("my-redis"), WithErrorCheck(func(cmd redis.Cmder, err error) bool {
+		checked = append(checked, cmd.Name())
+		return !errors.Is(err, context.Canceled)
+	}))
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := client.WithContext(canceled).Get("test_key").Err()
+	assert.True(errors.Is(err, context.Canceled))
+	err = client.Get("non_existent_key").Err()
+	assert.Equal(redis.Nil, err)
+	client.Set("test_key", "test_value", 0)
+	err = client.Incr("test_key").Err()
+	assert.NotNil(err)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 4)
+	assert.Nil(spans[0].Tag(ext.Error))
+	assert.Equal(ErrorClassCanceled, spans[0].Tag(ext.ErrorType))
+	assert.Nil(spans[1].Tag(ext.Error))
+	assert.Equal(err, spans[3].Tag(ext.Error))
+	assert.Equal([]string{"get", "incr"}, checked)
+}
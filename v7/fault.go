@@ -0,0 +1,247 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redis
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+type faultConfig struct {
+	commands    map[string]bool
+	keyPattern  string
+	probability float64
+	latency     time.Duration
+	err         error
+	rand        *rand.Rand
+}
+
+// FaultOption represents an option that can be used to create a FaultHook.
+type FaultOption func(*faultConfig)
+
+// WithFaultCommands restricts the faults to the given commands, such as
+// "get" or "hset". By default, all commands are affected.
+func WithFaultCommands(commands ...string) FaultOption {
+	return func(cfg *faultConfig) {
+		cfg.commands = make(map[string]bool, len(commands))
+		for _, c := range commands {
+			cfg.commands[strings.ToLower(c)] = true
+		}
+	}
+}
+
+// WithFaultKeyPattern restricts the faults to the commands whose first
+// argument, which is the key of most commands, matches pattern as defined by
+// path.Match, such as "session:*".
+func WithFaultKeyPattern(pattern string) FaultOption {
+	return func(cfg *faultConfig) {
+		cfg.keyPattern = pattern
+	}
+}
+
+// WithFaultProbability sets the probability, between 0 and 1, that a matching
+// command is affected. It defaults to 1.
+func WithFaultProbability(p float64) FaultOption {
+	return func(cfg *faultConfig) {
+		cfg.probability = p
+	}
+}
+
+// WithFaultSeed seeds the random source deciding which commands are
+// affected, for reproducible runs.
+func WithFaultSeed(seed int64) FaultOption {
+	return func(cfg *faultConfig) {
+		cfg.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// WithFaultLatency delays the affected commands by d, or until their context
+// is done.
+func WithFaultLatency(d time.Duration) FaultOption {
+	return func(cfg *faultConfig) {
+		cfg.latency = d
+	}
+}
+
+// WithFaultError makes the affected commands fail with err, for instance
+// redis.Nil, ErrFaultTimeout or an error reply returned by NewReplyError.
+func WithFaultError(err error) FaultOption {
+	return func(cfg *faultConfig) {
+		cfg.err = err
+	}
+}
+
+// FaultHook is a redis.Hook which injects latency and errors into the
+// commands matching its options, to verify how an application and its traces
+// behave when Redis is slow or failing. Add it before WrapClient so that the
+// spans include the faults. As go-redis v7 skips the AfterProcess hooks when a
+// BeforeProcess hook fails, the faults are injected once the commands have run:
+// the affected commands are sent to Redis, then are delayed and fail, without
+// being retried.
+//
+// A pipeline is affected as a whole if one of its commands matches: all its
+// commands fail with the error.
+type FaultHook struct {
+	cfg *faultConfig
+	mu  sync.Mutex // guards cfg.rand
+}
+
+// NewFaultHook returns a FaultHook configured with the given options.
+func NewFaultHook(opts ...FaultOption) *FaultHook {
+	cfg := &faultConfig{probability: 1}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.rand == nil {
+		cfg.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return &FaultHook{cfg: cfg}
+}
+
+var _ redis.Hook = (*FaultHook)(nil)
+
+func (h *FaultHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return contextWithFaultMark(ctx), nil
+}
+
+func (h *FaultHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if !h.matches(cmd) || !h.roll() {
+		return nil
+	}
+	err := h.inject(ctx)
+	if err != nil {
+		markFault(ctx)
+		cmd.SetErr(err)
+	}
+	return err
+}
+
+func (h *FaultHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return contextWithFaultMark(ctx), nil
+}
+
+func (h *FaultHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		if !h.matches(cmd) {
+			continue
+		}
+		if !h.roll() {
+			return nil
+		}
+		err := h.inject(ctx)
+		if err != nil {
+			markFault(ctx)
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// matches reports whether cmd matches the commands and the key pattern of h.
+func (h *FaultHook) matches(cmd redis.Cmder) bool {
+	if h.cfg.commands != nil && !h.cfg.commands[cmd.Name()] {
+		return false
+	}
+	if h.cfg.keyPattern == "" {
+		return true
+	}
+	args := cmd.Args()
+	if len(args) < 2 {
+		return false
+	}
+	ok, _ := path.Match(h.cfg.keyPattern, fmt.Sprint(args[1]))
+	return ok
+}
+
+// roll reports whether a matching command is affected.
+func (h *FaultHook) roll() bool {
+	switch p := h.cfg.probability; {
+	case p >= 1:
+		return true
+	case p <= 0:
+		return false
+	default:
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return h.cfg.rand.Float64() < p
+	}
+}
+
+// inject waits for the latency of h and returns its error.
+func (h *FaultHook) inject(ctx context.Context) error {
+	if h.cfg.latency > 0 {
+		t := time.NewTimer(h.cfg.latency)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return h.cfg.err
+}
+
+// faultContextKey is the key under which a FaultHook stores a *faultMark in
+// the context of the commands, which the hooks added after it, such as the
+// tracing Hook, see in their AfterProcess hooks, called after its own.
+type faultContextKey struct{}
+
+// faultMark records whether a command failed with the error of a FaultHook.
+type faultMark struct {
+	injected bool
+}
+
+func contextWithFaultMark(ctx context.Context) context.Context {
+	return context.WithValue(ctx, faultContextKey{}, new(faultMark))
+}
+
+// markFault marks the command of ctx as failing with the error of a
+// FaultHook.
+func markFault(ctx context.Context) {
+	if m, ok := ctx.Value(faultContextKey{}).(*faultMark); ok {
+		m.injected = true
+	}
+}
+
+// faultInjected reports whether ctx is the context of a command failing with
+// the error of a FaultHook, which go-redis did not retry.
+func faultInjected(ctx context.Context) bool {
+	m, ok := ctx.Value(faultContextKey{}).(*faultMark)
+	return ok && m.injected
+}
+
+// ErrFaultTimeout is a network timeout error, like the ones returned when the
+// read or write timeout of a client expires, for WithFaultError.
+var ErrFaultTimeout error = faultTimeoutError{}
+
+type faultTimeoutError struct{}
+
+func (faultTimeoutError) Error() string   { return "i/o timeout" }
+func (faultTimeoutError) Timeout() bool   { return true }
+func (faultTimeoutError) Temporary() bool { return true }
+
+// NewReplyError returns an error reply of Redis with the given message, such
+// as "LOADING Redis is loading the dataset in memory" or "READONLY You can't
+// write against a read only replica.", for WithFaultError.
+func NewReplyError(msg string) error {
+	return faultReplyError(msg)
+}
+
+type faultReplyError string
+
+func (e faultReplyError) Error() string { return string(e) }
+
+func (faultReplyError) RedisError() {}
@@ -0,0 +1,126 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+)
+
+func TestFaultHook(t *testing.T) {
+	opts := &redis.Options{Addr: testServer.Addr()}
+
+	t.Run("error", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		client := redis.NewClient(opts)
+		client.AddHook(NewFaultHook(
+			WithFaultCommands("GET"),
+			WithFaultKeyPattern("fault:*"),
+			WithFaultError(NewReplyError("LOADING Redis is loading the dataset in memory")),
+		))
+		WrapClient(client, WithServiceName("my-redis"))
+		err := client.Get("fault:key").Err()
+		assert.EqualError(err, "LOADING Redis is loading the dataset in memory")
+		assert.Equal(redis.Nil, client.Get("fault_missing").Err())
+		assert.Nil(client.Set("fault:key", "value", 0).Err())
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 3)
+		assert.Equal(err, spans[0].Tag(ext.Error))
+		assert.Equal("LOADING", spans[0].Tag(ext.ErrorType))
+		assert.Nil(spans[1].Tag(ext.Error))
+		assert.Nil(spans[2].Tag(ext.Error))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		client := redis.NewClient(opts)
+		client.AddHook(NewFaultHook(WithFaultError(ErrFaultTimeout)))
+		WrapClient(client, WithServiceName("my-redis"))
+		assert.Equal(ErrFaultTimeout, client.Get("fault_missing").Err())
+		pipeline := client.Pipeline()
+		pipeline.Get("fault_missing")
+		pipeline.Expire("pipeline_counter", time.Hour)
+		cmds, err := pipeline.Exec()
+		assert.Equal(ErrFaultTimeout, err)
+		for _, cmd := range cmds {
+			assert.Equal(ErrFaultTimeout, cmd.Err())
+		}
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 2)
+		assert.Equal(ErrorClassTimeout, spans[0].Tag(ext.ErrorType))
+		assert.Equal("2", spans[1].Tag("redis.pipeline_length"))
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		client := redis.NewClient(opts)
+		client.Set("fault_key", "value", 0)
+		client.AddHook(NewFaultHook(WithFaultError(redis.Nil)))
+		WrapClient(client, WithServiceName("my-redis"))
+		assert.Equal(redis.Nil, client.Get("fault_key").Err())
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 1)
+		assert.Nil(spans[0].Tag(ext.Error))
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		client := redis.NewClient(opts)
+		client.AddHook(NewFaultHook(WithFaultLatency(50 * time.Millisecond)))
+		WrapClient(client, WithServiceName("my-redis"))
+		assert.Equal(redis.Nil, client.Get("fault_missing").Err())
+		canceled, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.Equal(context.DeadlineExceeded, client.WithContext(canceled).Get("fault_missing").Err())
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 2)
+		assert.True(spans[0].FinishTime().Sub(spans[0].StartTime()) >= 50*time.Millisecond)
+		assert.Equal(true, spans[1].Tag("redis.deadline_exceeded"))
+	})
+
+	t.Run("probability", func(t *testing.T) {
+		assert := assert.New(t)
+		client := redis.NewClient(opts)
+		client.AddHook(NewFaultHook(
+			WithFaultError(ErrFaultTimeout),
+			WithFaultProbability(0.5),
+			WithFaultSeed(1),
+		))
+		var failed int
+		for i := 0; i < 100; i++ {
+			if client.Get("fault_missing").Err() == ErrFaultTimeout {
+				failed++
+			}
+		}
+		assert.True(failed > 0 && failed < 100, failed)
+
+		client = redis.NewClient(opts)
+		client.AddHook(NewFaultHook(WithFaultError(ErrFaultTimeout), WithFaultProbability(0)))
+		assert.Equal(redis.Nil, client.Get("fault_missing").Err())
+	})
+}
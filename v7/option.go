@@ -9,8 +9,11 @@ import (
 	"math"
 	"net"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-redis/redis/v7"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 )
 
 const (
@@ -20,11 +23,37 @@ const (
 )
 
 type clientConfig struct {
-	serviceName   string
-	analyticsRate float64
-	host          string
-	port          string
-	db            string
+	serviceName     string
+	analyticsRate   float64
+	host            string
+	port            string
+	db              string
+	rawCommand      bool
+	maxRawCommand   int
+	scripts         map[string]string
+	pubSubEnvelope  bool
+	blockingOpName  string
+	ignoredErrors   map[string]map[string]bool
+	errCheck        func(cmd redis.Cmder, err error) bool
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+	startHook       func(span ddtrace.Span, cmd redis.Cmder)
+	finishHook      func(span ddtrace.Span, cmd redis.Cmder)
+	peerService     string
+	tls             bool
+	tlsServerName   string
+	user            string
+	clientName      string
+	setClientName   bool
+	connName        string // the name set by NewClient with CLIENT SETNAME
+	measured        bool
+	commandOpName   string
+	pipelineOpName  string
+	maxRetries      int
+	minRetryBackoff time.Duration
+	maxRetryBackoff time.Duration
+	requireParent   bool
+	orphanHook      func(cmd redis.Cmder, d time.Duration)
 }
 
 // ClientOption represents an option that can be used to create or wrap a client.
@@ -37,6 +66,45 @@ func defaults(cfg *clientConfig) {
 	cfg.host = defaultHost
 	cfg.port = defaultPort
 	cfg.db = defaultDB
+	cfg.rawCommand = true
+	cfg.commandOpName = "redis.command"
+	cfg.pipelineOpName = "redis.command"
+}
+
+// newClientConfig returns a clientConfig with the defaults and the given options applied.
+func newClientConfig(opts ...ClientOption) *clientConfig {
+	cfg := new(clientConfig)
+	defaults(cfg)
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// clone returns a copy of cfg which can be modified by options without
+// affecting cfg.
+func (cfg *clientConfig) clone() *clientConfig {
+	c := *cfg
+	if cfg.scripts != nil {
+		c.scripts = make(map[string]string, len(cfg.scripts))
+		for sha, name := range cfg.scripts {
+			c.scripts[sha] = name
+		}
+	}
+	if cfg.ignoredErrors != nil {
+		c.ignoredErrors = make(map[string]map[string]bool, len(cfg.ignoredErrors))
+		for class, cmds := range cfg.ignoredErrors {
+			if cmds == nil {
+				c.ignoredErrors[class] = nil
+				continue
+			}
+			c.ignoredErrors[class] = make(map[string]bool, len(cmds))
+			for cmd := range cmds {
+				c.ignoredErrors[class][cmd] = true
+			}
+		}
+	}
+	return &c
 }
 
 // WithServiceName sets the given service name for the client.
@@ -76,7 +144,7 @@ func WithHost(host string) ClientOption {
 	}
 }
 
-// WithPort sets the port for the client.
+// WithPort sets the port for the client. An empty port is not tagged.
 func WithPort(port string) ClientOption {
 	return func(cfg *clientConfig) {
 		cfg.port = port
@@ -90,16 +158,253 @@ func WithDB(db string) ClientOption {
 	}
 }
 
+// WithRawCommand enables or disables the redis.raw_command tag. When disabled,
+// pipeline spans use only the command names as their resource.
+func WithRawCommand(on bool) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.rawCommand = on
+	}
+}
+
+// WithMaxRawCommandLength sets the maximum length in bytes of the raw command
+// tag and of the pipeline resource. Longer values are truncated and suffixed
+// with "...". A value of 0 or less means no limit, which is the default.
+func WithMaxRawCommandLength(n int) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.maxRawCommand = n
+	}
+}
+
+// WithScript registers a script under the given name, so that EVAL and
+// EVALSHA spans running it are tagged with redis.script.name.
+func WithScript(name string, script *redis.Script) ClientOption {
+	return func(cfg *clientConfig) {
+		if cfg.scripts == nil {
+			cfg.scripts = make(map[string]string)
+		}
+		cfg.scripts[script.Hash()] = name
+	}
+}
+
+// WithPubSubEnvelope enables wrapping the payloads published with Publish in
+// an envelope carrying the trace context, and unwrapping them in PubSub.
+// Publishers and subscribers of a channel must agree on this option.
+func WithPubSubEnvelope(on bool) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.pubSubEnvelope = on
+	}
+}
+
+// WithBlockingOperationName sets the operation name of the spans of blocking
+// commands such as BLPOP, XREAD BLOCK or WAIT, so that they can be told apart
+// from regular commands. By default they are named like the other commands.
+func WithBlockingOperationName(name string) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.blockingOpName = name
+	}
+}
+
+// WithMeasured marks the spans as measured, so that trace metrics are
+// computed for them even when they are not the top-level spans of their
+// service.
+func WithMeasured(on bool) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.measured = on
+	}
+}
+
+// WithOperationName sets the operation name of the spans of commands. It
+// defaults to "redis.command".
+func WithOperationName(name string) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.commandOpName = name
+	}
+}
+
+// WithPipelineOperationName sets the operation name of the spans of
+// pipelines, such as "redis.pipeline", so that their trace metrics are not
+// mixed with the ones of single commands. It defaults to "redis.command".
+func WithPipelineOperationName(name string) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.pipelineOpName = name
+	}
+}
+
+// WithIgnoredErrorClass prevents errors of the given class, one of the
+// ErrorClass constants or a Redis error reply prefix such as "BUSYGROUP", from
+// marking spans as errors. If commands are given, only the errors of these commands are
+// ignored. The class is still recorded in the error.type tag.
+func WithIgnoredErrorClass(class string, commands ...string) ClientOption {
+	return func(cfg *clientConfig) {
+		if cfg.ignoredErrors == nil {
+			cfg.ignoredErrors = make(map[string]map[string]bool)
+		}
+		cmds, ok := cfg.ignoredErrors[class]
+		if ok && cmds == nil {
+			// already ignored for all commands
+			return
+		}
+		if len(commands) == 0 {
+			cfg.ignoredErrors[class] = nil
+			return
+		}
+		if cmds == nil {
+			cmds = make(map[string]bool, len(commands))
+			cfg.ignoredErrors[class] = cmds
+		}
+		for _, c := range commands {
+			cmds[strings.ToLower(c)] = true
+		}
+	}
+}
+
+// WithErrorCheck sets a function deciding whether the error returned by a
+// command should mark its span as an error. It is not called for redis.Nil,
+// which never marks spans as errors, and applies before WithIgnoredErrorClass.
+func WithErrorCheck(fn func(cmd redis.Cmder, err error) bool) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.errCheck = fn
+	}
+}
+
+// WithSpanStartHook sets a function called with every span started for a
+// command, for instance to add tags computed from its arguments. For
+// pipelines, fn is called with the pipeline span for each of its commands.
+func WithSpanStartHook(fn func(span ddtrace.Span, cmd redis.Cmder)) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.startHook = fn
+	}
+}
+
+// WithSpanFinishHook sets a function called with every span of a command
+// right before it is finished, for instance to add tags computed from its
+// result. For pipelines, fn is called with the pipeline span for each of its
+// commands.
+func WithSpanFinishHook(fn func(span ddtrace.Span, cmd redis.Cmder)) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.finishHook = fn
+	}
+}
+
+// WithRequireParent makes the commands and pipelines only traced when their
+// context carries a parent span, so that background jobs or clients used
+// without WithContext do not create a trace per command.
+func WithRequireParent(on bool) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.requireParent = on
+	}
+}
+
+// WithOrphanHook sets a function called when a command which was not traced
+// because of WithRequireParent finishes, with its duration, for instance to
+// aggregate these commands into metrics. For pipelines, fn is called for each
+// of their commands with the duration of the pipeline.
+func WithOrphanHook(fn func(cmd redis.Cmder, d time.Duration)) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.orphanHook = fn
+	}
+}
+
+// WithPeerService sets the peer.service tag of the spans. By default, the tag
+// is not set, so that Datadog infers the peer service itself.
+func WithPeerService(name string) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.peerService = name
+	}
+}
+
+// WithClientName sets the connection name of the client, which is tagged on
+// the spans as redis.client_name.
+func WithClientName(name string) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.clientName = name
+	}
+}
+
+// WithSetClientName makes NewClient and NewClientFromURL send CLIENT SETNAME
+// on every new connection, so that CLIENT LIST on the server maps connections
+// back to the service. The name is the one given to WithClientName, or the
+// service name. WrapClient and NewHook do not send CLIENT SETNAME, so their
+// spans are only tagged with the name given to WithClientName.
+func WithSetClientName(on bool) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.setClientName = on
+	}
+}
+
+// withConnectionName records the name set on the connections of the client
+// by NewClient, which is tagged on the spans as redis.client_name.
+func withConnectionName(name string) ClientOption {
+	return func(cfg *clientConfig) {
+		cfg.connName = name
+	}
+}
+
+// connectionName returns the name NewClient sets on the connections of the
+// client with CLIENT SETNAME.
+func (cfg *clientConfig) connectionName() string {
+	name := cfg.clientName
+	if name == "" {
+		name = cfg.serviceName
+	}
+	return sanitizeClientName(name)
+}
+
+// clientNameTag returns the redis.client_name tag of the spans: the name set
+// on the connections by NewClient, or else the name given to WithClientName.
+// The service name is not used as the connections do not carry it.
+func (cfg *clientConfig) clientNameTag() string {
+	if cfg.connName != "" {
+		return cfg.connName
+	}
+	return sanitizeClientName(cfg.clientName)
+}
+
+// sanitizeClientName replaces the characters which CLIENT SETNAME rejects,
+// spaces and special characters, in name.
+func sanitizeClientName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
 // WithRedisOptions sets the redis.Option for the client.
+//
+// go-redis retries the commands failing with a network error or a transient
+// error reply within a single call of the hooks, and the Limiter it notifies
+// of each attempt is not given the context of the command. The attempts and
+// their backoff are therefore not visible to a Hook: the span of a command
+// covers all its attempts and is tagged with the error of the last one. The
+// spans are tagged with the retry policy of opts instead, and with
+// redis.retry.exhausted when the command failed with an error which go-redis
+// retries, meaning that all the attempts failed.
 func WithRedisOptions(opts *redis.Options) ClientOption {
 	return func(cfg *clientConfig) {
-		host, port, err := net.SplitHostPort(opts.Addr)
-		if err != nil {
-			host = defaultHost
-			port = defaultPort
+		if opts.Network == "unix" || (opts.Network == "" && strings.HasPrefix(opts.Addr, "/")) {
+			cfg.host = opts.Addr
+			cfg.port = ""
+		} else {
+			host, port, err := net.SplitHostPort(opts.Addr)
+			if err != nil {
+				host = defaultHost
+				port = defaultPort
+			}
+			cfg.host = host
+			cfg.port = port
 		}
-		cfg.host = host
-		cfg.port = port
 		cfg.db = strconv.Itoa(opts.DB)
+		cfg.user = opts.Username
+		cfg.tls = opts.TLSConfig != nil
+		if opts.TLSConfig != nil {
+			cfg.tlsServerName = opts.TLSConfig.ServerName
+		}
+		cfg.readTimeout = opts.ReadTimeout
+		cfg.writeTimeout = opts.WriteTimeout
+		cfg.maxRetries = opts.MaxRetries
+		cfg.minRetryBackoff = opts.MinRetryBackoff
+		cfg.maxRetryBackoff = opts.MaxRetryBackoff
 	}
 }
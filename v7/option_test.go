@@ -0,0 +1,151 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+)
+
+func TestWithRedisOptions(t *testing.T) {
+	t.Run("tcp", func(t *testing.T) {
+		cfg := newClientConfig(WithRedisOptions(&redis.Options{Addr: "redis.local:6380", DB: 2}))
+		assert.Equal(t, "redis.local", cfg.host)
+		assert.Equal(t, "6380", cfg.port)
+		assert.Equal(t, "2", cfg.db)
+		assert.False(t, cfg.tls)
+	})
+
+	t.Run("unix", func(t *testing.T) {
+		cfg := newClientConfig(WithRedisOptions(&redis.Options{Network: "unix", Addr: "/var/run/redis.sock"}))
+		assert.Equal(t, "/var/run/redis.sock", cfg.host)
+		assert.Equal(t, "", cfg.port)
+
+		cfg = newClientConfig(WithRedisOptions(&redis.Options{Addr: "/tmp/redis.sock"}))
+		assert.Equal(t, "/tmp/redis.sock", cfg.host)
+		assert.Equal(t, "", cfg.port)
+	})
+
+	t.Run("tls", func(t *testing.T) {
+		cfg := newClientConfig(WithRedisOptions(&redis.Options{
+			Addr:      "redis.local:6380",
+			TLSConfig: &tls.Config{ServerName: "redis.example.com"},
+		}))
+		assert.True(t, cfg.tls)
+		assert.Equal(t, "redis.example.com", cfg.tlsServerName)
+	})
+}
+
+func TestClientTags(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	hook := NewHook(WithRedisOptions(&redis.Options{
+		Network:   "unix",
+		Addr:      "/var/run/redis.sock",
+		TLSConfig: &tls.Config{ServerName: "redis.example.com"},
+	}))
+	cmd := redis.NewStringCmd("get", "key")
+	ctx, _ := hook.BeforeProcess(context.Background(), cmd)
+	hook.AfterProcess(ctx, cmd)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 1)
+	assert.Equal("/var/run/redis.sock", spans[0].Tag(ext.TargetHost))
+	assert.Nil(spans[0].Tag(ext.TargetPort))
+	assert.Equal(true, spans[0].Tag("redis.tls"))
+	assert.Equal("redis.example.com", spans[0].Tag("redis.tls.server_name"))
+}
+
+func TestNewClientFromURL(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	client, err := NewClientFromURL("redis://"+testServer.Addr()+"/2", WithServiceName("my-redis"))
+	assert.Nil(err)
+	client.Get("test_key")
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 1)
+	assert.Equal("my-redis", spans[0].Tag(ext.ServiceName))
+	assert.Equal("127.0.0.1", spans[0].Tag(ext.TargetHost))
+	assert.Equal(testServer.Port(), spans[0].Tag(ext.TargetPort))
+	assert.Equal("2", spans[0].Tag("out.db"))
+	assert.Nil(spans[0].Tag("redis.tls"))
+
+	_, err = NewClientFromURL("http://127.0.0.1:6379")
+	assert.NotNil(err)
+}
+
+func TestClientName(t *testing.T) {
+	opts := &redis.Options{Addr: testServer.Addr(), Username: "app"}
+
+	t.Run("tags", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		hook := NewHook(WithRedisOptions(opts), WithClientName("worker"))
+		cmd := redis.NewStringCmd("get", "key")
+		ctx, _ := hook.BeforeProcess(context.Background(), cmd)
+		hook.AfterProcess(ctx, cmd)
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 1)
+		assert.Equal("app", spans[0].Tag(ext.DBUser))
+		assert.Equal("worker", spans[0].Tag("redis.client_name"))
+	})
+
+	t.Run("set-client-name", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		var connected bool
+		opts := &redis.Options{Addr: testServer.Addr(), OnConnect: func(cn *redis.Conn) error {
+			connected = true
+			return nil
+		}}
+		client := NewClient(opts, WithServiceName("my redis"), WithSetClientName(true))
+		name, err := client.ClientGetName().Result()
+		assert.Nil(err)
+		assert.Equal("my_redis", name)
+		assert.True(connected)
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 1)
+		assert.Equal("my_redis", spans[0].Tag("redis.client_name"))
+		assert.Nil(spans[0].Tag(ext.DBUser))
+	})
+
+	t.Run("not-set", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		// without NewClient, the connections are not named after the service
+		hook := NewHook(WithRedisOptions(opts), WithServiceName("my-redis"), WithSetClientName(true))
+		cmd := redis.NewStringCmd("get", "key")
+		ctx, _ := hook.BeforeProcess(context.Background(), cmd)
+		hook.AfterProcess(ctx, cmd)
+		client := WrapClient(redis.NewClient(opts), WithServiceName("my-redis"), WithSetClientName(true))
+		client.Get("key")
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 2)
+		for _, s := range spans {
+			assert.Nil(s.Tag("redis.client_name"))
+		}
+	})
+}
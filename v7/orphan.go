@@ -0,0 +1,58 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// isOrphan reports whether the commands run with ctx should not be traced
+// because they have no parent span while one is required.
+func (cfg *clientConfig) isOrphan(ctx context.Context) bool {
+	if !cfg.requireParent {
+		return false
+	}
+	_, ok := tracer.SpanFromContext(ctx)
+	return !ok
+}
+
+// orphanContextKey is the key under which a Hook stores the start of the
+// orphan commands, for the function set with WithOrphanHook.
+type orphanContextKey struct {
+	h *Hook
+}
+
+// orphan is an orphan command or pipeline being run.
+type orphan struct {
+	start time.Time
+	cfg   *clientConfig
+}
+
+// contextWithOrphan returns a copy of ctx recording the start of an orphan
+// command, if cfg has a function to call when it finishes.
+func (h *Hook) contextWithOrphan(ctx context.Context, cfg *clientConfig) context.Context {
+	if cfg.orphanHook == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, orphanContextKey{h}, orphan{time.Now(), cfg})
+}
+
+// finishOrphan calls the function set with WithOrphanHook with the given
+// commands, if they were started as orphans.
+func (h *Hook) finishOrphan(ctx context.Context, cmds ...redis.Cmder) {
+	o, ok := ctx.Value(orphanContextKey{h}).(orphan)
+	if !ok {
+		return
+	}
+	d := time.Since(o.start)
+	for _, cmd := range cmds {
+		o.cfg.orphanHook(cmd, d)
+	}
+}
@@ -14,6 +14,9 @@ import (
 	"math"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
 
 	"github.com/go-redis/redis/v7"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
@@ -24,10 +27,46 @@ import (
 // NewClient returns a new Client that is traced with the default tracer under
 // the service name "redis".
 func NewClient(opt *redis.Options, opts ...ClientOption) *redis.Client {
+	if cfg := newClientConfig(opts...); cfg.setClientName {
+		name := cfg.connectionName()
+		opt = withClientSetName(opt, name)
+		opts = append(opts[:len(opts):len(opts)], withConnectionName(name))
+	}
 	return WrapClient(redis.NewClient(opt), opts...)
 }
 
+// withClientSetName returns a copy of opt which sends CLIENT SETNAME on every
+// new connection, before calling opt.OnConnect.
+func withClientSetName(opt *redis.Options, name string) *redis.Options {
+	o := *opt
+	onConnect := opt.OnConnect
+	o.OnConnect = func(cn *redis.Conn) error {
+		if err := cn.ClientSetName(name).Err(); err != nil {
+			return err
+		}
+		if onConnect != nil {
+			return onConnect(cn)
+		}
+		return nil
+	}
+	return &o
+}
+
+// NewClientFromURL returns a new Client for the given URL, as parsed by
+// redis.ParseURL, that is traced like NewClient.
+func NewClientFromURL(url string, opts ...ClientOption) (*redis.Client, error) {
+	opt, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(opt, opts...), nil
+}
+
 // WrapClient wraps a given redis.Client with a tracer under the given service name.
+// If c is already traced, for instance because it was wrapped by a library, the
+// commands are only traced by the Hook added first, with its configuration:
+// the commands it does not trace, because it is disabled or requires a parent
+// span, are not traced by the Hook added by WrapClient either.
 func WrapClient(c *redis.Client, opts ...ClientOption) *redis.Client {
 	_opts := []ClientOption{WithRedisOptions(c.Options())}
 	_opts = append(_opts, opts...)
@@ -37,90 +76,450 @@ func WrapClient(c *redis.Client, opts ...ClientOption) *redis.Client {
 
 // Hook imprements redis.Hook.
 type Hook struct {
+	// state holds the current *hookState. It is replaced as a whole when the
+	// Hook is reconfigured.
+	state atomic.Value
+	// mu serializes the updates of the configuration.
+	mu sync.Mutex
+	// disabled is 1 when the Hook does not trace the commands.
+	disabled int32
+}
+
+// hookState is the configuration of a Hook, with the span options computed
+// from it once and shared by all the spans.
+type hookState struct {
 	cfg *clientConfig
+	// spanOpts are the options which do not depend on the command.
+	spanOpts []ddtrace.StartSpanOption
 }
 
 // NewHook returns a new Hook.
 func NewHook(opts ...ClientOption) *Hook {
-	cfg := new(clientConfig)
-	defaults(cfg)
+	h := new(Hook)
+	h.configure(newClientConfig(opts...))
+	return h
+}
+
+// configure atomically replaces the configuration of h and the span options
+// computed from it. The commands in flight finish with the configuration they
+// started with.
+func (h *Hook) configure(cfg *clientConfig) {
+	h.state.Store(&hookState{cfg: cfg, spanOpts: cfg.spanOptions()})
+}
+
+// load returns the current state of h.
+func (h *Hook) load() *hookState {
+	return h.state.Load().(*hookState)
+}
+
+// SetEnabled enables or disables the tracing of the commands, for instance to
+// remove the overhead of tracing during an incident. The spans of the
+// commands in flight are finished normally. A Hook is enabled when created.
+// It is safe to call concurrently with the commands.
+func (h *Hook) SetEnabled(on bool) {
+	var disabled int32
+	if !on {
+		disabled = 1
+	}
+	atomic.StoreInt32(&h.disabled, disabled)
+}
+
+// Enabled reports whether h traces the commands.
+func (h *Hook) Enabled() bool {
+	return atomic.LoadInt32(&h.disabled) == 0
+}
+
+// Update applies opts to the configuration of h, so that options such as
+// WithServiceName or WithAnalyticsRate take effect for the next commands
+// without recreating the client. The commands in flight finish with the
+// previous configuration. Options only used when creating a client, such as
+// WithSetClientName, have no effect. It is safe to call concurrently with the
+// commands.
+func (h *Hook) Update(opts ...ClientOption) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cfg := h.load().cfg.clone()
 	for _, opt := range opts {
 		opt(cfg)
 	}
-	return &Hook{
-		cfg: cfg,
-	}
+	h.configure(cfg)
 }
 
 var _ redis.Hook = (*Hook)(nil)
 
+// spanContextKey is the key under which the Hooks store the spans they start,
+// so that their After methods only finish these spans, even when other hooks
+// are involved or their Before methods did not run, and so that a command is
+// not traced twice when a client is wrapped twice.
+type spanContextKey struct{}
+
+// hookSpan is a span started by a Hook for a command or a pipeline, with the
+// state it was started with.
+type hookSpan struct {
+	h    *Hook
+	span ddtrace.Span
+	st   *hookState
+	// cmd is the command, or the first command of the pipeline, and n is the
+	// length of the pipeline, or 0 for a command.
+	cmd redis.Cmder
+	n   int
+}
+
+// pipelineKey returns the first command and the length of cmds, which
+// identify a pipeline in a hookSpan.
+func pipelineKey(cmds []redis.Cmder) (redis.Cmder, int) {
+	if len(cmds) == 0 {
+		return nil, 0
+	}
+	return cmds[0], len(cmds)
+}
+
+func (h *Hook) contextWithSpan(ctx context.Context, span ddtrace.Span, st *hookState, cmd redis.Cmder, n int) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, hookSpan{h, span, st, cmd, n})
+}
+
+func (h *Hook) spanFromContext(ctx context.Context, cmd redis.Cmder, n int) (ddtrace.Span, *hookState, bool) {
+	hs, ok := ctx.Value(spanContextKey{}).(hookSpan)
+	if !ok || hs.h != h || hs.cmd != cmd || hs.n != n {
+		return nil, nil, false
+	}
+	return hs.span, hs.st, true
+}
+
+// isTraced reports whether ctx carries the span started by a Hook for cmd, or
+// for a pipeline of n commands starting with cmd, as when a client with two
+// Hooks runs it.
+func isTraced(ctx context.Context, cmd redis.Cmder, n int) bool {
+	hs, ok := ctx.Value(spanContextKey{}).(hookSpan)
+	return ok && hs.cmd == cmd && hs.n == n
+}
+
+// componentName is the value of the component tag of the spans.
+const componentName = "go-redis/redis.v7"
+
 func (h *Hook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
-	raw := cmd.String()
-	parts := strings.Split(raw, " ")
-	length := len(parts) - 1
-	opts := []ddtrace.StartSpanOption{
-		tracer.SpanType(ext.SpanTypeRedis),
-		tracer.ServiceName(h.cfg.serviceName),
-		tracer.ResourceName(parts[0]),
-		tracer.Tag(ext.TargetHost, h.cfg.host),
-		tracer.Tag(ext.TargetPort, h.cfg.port),
-		tracer.Tag("out.db", h.cfg.db),
-		tracer.Tag("redis.raw_command", raw),
-		tracer.Tag("redis.args_length", strconv.Itoa(length)),
+	if skipTracing(ctx) || isTraced(ctx, cmd, 0) {
+		return ctx, nil
+	}
+	// the commands which are not traced are skipped by the other Hooks of
+	// the client too, so that a client wrapped twice is traced as configured
+	// by the Hook added first
+	if !h.Enabled() {
+		return ContextWithSkipTracing(ctx), nil
+	}
+	st := h.load()
+	cfg := st.cfg
+	if cfg.isOrphan(ctx) {
+		return h.contextWithOrphan(ContextWithSkipTracing(ctx), cfg), nil
+	}
+	timeout, blocking := blockingTimeout(cmd)
+	operationName := cfg.commandOpName
+	if blocking && cfg.blockingOpName != "" {
+		operationName = cfg.blockingOpName
+	}
+	ctxOpts := spanOptionsFromContext(ctx)
+	span := startSpan(ctx, operationName, st.spanOpts, ctxOpts)
+	if isRecorded(span) {
+		span.SetTag(ext.ResourceName, cmd.Name())
+		span.SetTag("redis.args_length", strconv.Itoa(len(cmd.Args())))
+		cfg.setScriptTags(ctx, span, cmd)
+		setDeadlineTags(ctx, span)
+		if blocking {
+			span.SetTag("redis.blocking", true)
+			span.SetTag("redis.blocking.timeout_ms", milliseconds(timeout))
+		}
+		setContextTags(span, ctxOpts)
+		if cfg.rawCommand {
+			span.SetTag("redis.raw_command", truncate(cmd.String(), cfg.maxRawCommand))
+		}
+	}
+	if cfg.startHook != nil {
+		cfg.startHook(span, cmd)
 	}
-	if !math.IsNaN(h.cfg.analyticsRate) {
-		opts = append(opts, tracer.Tag(ext.EventSampleRate, h.cfg.analyticsRate))
+	if !cfg.keepSpan(span) {
+		return ctx, nil
 	}
-	_, ctxWithSpan := tracer.StartSpanFromContext(ctx, "redis.command", opts...)
-	return ctxWithSpan, nil
+	return h.contextWithSpan(tracer.ContextWithSpan(ctx, span), span, st, cmd, 0), nil
 }
 
 func (h *Hook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
-	span, _ := tracer.SpanFromContext(ctx)
-	var finishOpts []ddtrace.FinishOption
+	span, st, ok := h.spanFromContext(ctx, cmd, 0)
+	if !ok {
+		h.finishOrphan(ctx, cmd)
+		return cmd.Err()
+	}
+	cfg := st.cfg
+	if _, ok := blockingTimeout(cmd); ok {
+		span.SetTag("redis.blocking.timed_out", blockingTimedOut(cmd))
+	}
 	err := cmd.Err()
-	if err != redis.Nil {
-		finishOpts = append(finishOpts, tracer.WithError(err))
+	cfg.setError(ctx, span, cmd, err)
+	setContextError(ctx, span, err)
+	_, blocking := blockingTimeout(cmd)
+	cfg.setRetryExhausted(ctx, span, err, !blocking)
+	if cfg.finishHook != nil {
+		cfg.finishHook(span, cmd)
 	}
-	span.Finish(finishOpts...)
+	span.Finish()
 	return err
 }
 
+// setError tags span with err and its class. The span is only marked as an
+// error if err is not redis.Nil, passes the configured error check and its
+// class is not ignored.
+func (cfg *clientConfig) setError(ctx context.Context, span ddtrace.Span, cmd redis.Cmder, err error) {
+	if err == nil || err == redis.Nil {
+		return
+	}
+	class, prefix := classifyError(err)
+	if prefix != "" {
+		span.SetTag("redis.error_prefix", prefix)
+	}
+	if cfg.isError(ctx, cmd, err, class) {
+		span.SetTag(ext.Error, err)
+	}
+	if class != "" {
+		// set after ext.Error, which sets error.type to the Go type of err
+		span.SetTag(ext.ErrorType, class)
+	}
+}
+
+// isError reports whether err, of the given class, should mark the span of cmd
+// as an error.
+func (cfg *clientConfig) isError(ctx context.Context, cmd redis.Cmder, err error, class string) bool {
+	if isExpectedNoScript(ctx, err) {
+		return false
+	}
+	if cfg.errCheck != nil && !cfg.errCheck(cmd, err) {
+		return false
+	}
+	return !cfg.isIgnoredError(cmd.Name(), class)
+}
+
 func (h *Hook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
-	raw := commandsToString(cmds)
-	parts := strings.Split(raw, " ")
-	length := len(parts) - 1
-	opts := []ddtrace.StartSpanOption{
-		tracer.SpanType(ext.SpanTypeRedis),
-		tracer.ServiceName(h.cfg.serviceName),
-		tracer.ResourceName(parts[0]),
-		tracer.Tag(ext.TargetHost, h.cfg.host),
-		tracer.Tag(ext.TargetPort, h.cfg.port),
-		tracer.Tag("out.db", h.cfg.db),
-		tracer.Tag("redis.raw_command", raw),
-		tracer.Tag("redis.args_length", strconv.Itoa(length)),
+	first, n := pipelineKey(cmds)
+	if skipTracing(ctx) || isTraced(ctx, first, n) {
+		return ctx, nil
+	}
+	if !h.Enabled() {
+		return ContextWithSkipTracing(ctx), nil
+	}
+	st := h.load()
+	cfg := st.cfg
+	if cfg.isOrphan(ctx) {
+		return h.contextWithOrphan(ContextWithSkipTracing(ctx), cfg), nil
+	}
+	ctxOpts := spanOptionsFromContext(ctx)
+	span := startSpan(ctx, cfg.pipelineOpName, st.spanOpts, ctxOpts)
+	if isRecorded(span) {
+		var length int
+		for _, cmd := range cmds {
+			length += len(cmd.Args())
+		}
+		span.SetTag("redis.args_length", strconv.Itoa(length))
+		setDeadlineTags(ctx, span)
+		setContextTags(span, ctxOpts)
 	}
-	if !math.IsNaN(h.cfg.analyticsRate) {
-		opts = append(opts, tracer.Tag(ext.EventSampleRate, h.cfg.analyticsRate))
+	if cfg.startHook != nil {
+		for _, cmd := range cmds {
+			cfg.startHook(span, cmd)
+		}
 	}
-	_, ctxWithSpan := tracer.StartSpanFromContext(ctx, "redis.command", opts...)
-	return ctxWithSpan, nil
+	if !cfg.keepSpan(span) {
+		return ctx, nil
+	}
+	return h.contextWithSpan(tracer.ContextWithSpan(ctx, span), span, st, first, n), nil
 }
 
 func (h *Hook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
-	span, _ := tracer.SpanFromContext(ctx)
-	span.SetTag(ext.ResourceName, commandsToString(cmds))
-	span.SetTag("redis.pipeline_length", strconv.Itoa(len(cmds)))
+	first, n := pipelineKey(cmds)
+	span, st, ok := h.spanFromContext(ctx, first, n)
+	if !ok {
+		h.finishOrphan(ctx, cmds...)
+		return nil
+	}
+	cfg := st.cfg
+	if isRecorded(span) {
+		cfg.setPipelineCommands(span, cmds)
+		span.SetTag("redis.pipeline_length", strconv.Itoa(len(cmds)))
+	}
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil && err != redis.Nil {
+			setContextError(ctx, span, err)
+			break
+		}
+	}
+	cfg.setRetryExhausted(ctx, span, pipelineError(cmds), true)
+	if cfg.finishHook != nil {
+		for _, cmd := range cmds {
+			cfg.finishHook(span, cmd)
+		}
+	}
 	span.Finish()
 	return nil
 }
 
+// spanOptions returns the options of the spans of commands and pipelines
+// which only depend on the configuration.
+func (cfg *clientConfig) spanOptions() []ddtrace.StartSpanOption {
+	opts := []ddtrace.StartSpanOption{
+		tracer.SpanType(ext.SpanTypeRedis),
+		tracer.ServiceName(cfg.serviceName),
+	}
+	opts = append(opts, cfg.clientTags()...)
+	opts = append(opts, cfg.timeoutTags()...)
+	opts = append(opts, cfg.retryTags()...)
+	if !math.IsNaN(cfg.analyticsRate) {
+		opts = append(opts, tracer.Tag(ext.EventSampleRate, cfg.analyticsRate))
+	}
+	if cfg.measured {
+		opts = append(opts, tracer.Measured())
+	}
+	return opts
+}
+
+// clientTags returns the standard tags of the spans of a Redis client.
+func (cfg *clientConfig) clientTags() []ddtrace.StartSpanOption {
+	opts := []ddtrace.StartSpanOption{
+		tracer.Tag(ext.TargetHost, cfg.host),
+		tracer.Tag("out.db", cfg.db),
+		tracer.Tag("component", componentName),
+		tracer.Tag("span.kind", "client"),
+		tracer.Tag("db.system", "redis"),
+		tracer.Tag(ext.DBInstance, cfg.db),
+	}
+	if cfg.peerService != "" {
+		opts = append(opts, tracer.Tag(ext.PeerService, cfg.peerService))
+	}
+	if cfg.port != "" {
+		opts = append(opts, tracer.Tag(ext.TargetPort, cfg.port))
+	}
+	if cfg.user != "" {
+		opts = append(opts, tracer.Tag(ext.DBUser, cfg.user))
+	}
+	if name := cfg.clientNameTag(); name != "" {
+		opts = append(opts, tracer.Tag("redis.client_name", name))
+	}
+	if cfg.tls {
+		opts = append(opts, tracer.Tag("redis.tls", true))
+		if cfg.tlsServerName != "" {
+			opts = append(opts, tracer.Tag("redis.tls.server_name", cfg.tlsServerName))
+		}
+	}
+	return opts
+}
+
+// helperSpanOptions returns the options of the spans started by the helpers
+// of this package, such as Script.Run or XAdd, which are tagged like the
+// spans of the commands of the client, with the given span kind.
+func (cfg *clientConfig) helperSpanOptions(spanType, spanKind, resource string) []ddtrace.StartSpanOption {
+	opts := []ddtrace.StartSpanOption{
+		tracer.SpanType(spanType),
+		tracer.ServiceName(cfg.serviceName),
+		tracer.ResourceName(resource),
+	}
+	opts = append(opts, cfg.clientTags()...)
+	opts = append(opts, tracer.Tag("span.kind", spanKind))
+	if !math.IsNaN(cfg.analyticsRate) {
+		opts = append(opts, tracer.Tag(ext.EventSampleRate, cfg.analyticsRate))
+	}
+	if cfg.measured {
+		opts = append(opts, tracer.Measured())
+	}
+	return opts
+}
+
+// newHelperConfig returns the configuration of a helper of this package
+// called with c: the options of c, then opts, as for WrapClient.
+func newHelperConfig(c *redis.Client, opts []ClientOption) *clientConfig {
+	opts = append([]ClientOption{WithRedisOptions(c.Options())}, opts...)
+	return newClientConfig(opts...)
+}
+
+// setPipelineCommands sets the resource name and the raw command of a
+// pipeline span, formatting the commands and their replies once.
+func (cfg *clientConfig) setPipelineCommands(span ddtrace.Span, cmds []redis.Cmder) {
+	if !cfg.rawCommand {
+		span.SetTag(ext.ResourceName, commandNamesToString(cmds, cfg.maxRawCommand))
+		return
+	}
+	raw := commandsToString(cmds, cfg.maxRawCommand)
+	span.SetTag(ext.ResourceName, raw)
+	span.SetTag("redis.raw_command", raw)
+}
+
+// startSpan starts a span with the options of a Hook followed by the options
+// of ctx, as a child of the span of ctx if any. It does not allocate when ctx
+// carries neither a span nor options.
+func startSpan(ctx context.Context, operationName string, opts, ctxOpts []ddtrace.StartSpanOption) ddtrace.Span {
+	parent, ok := tracer.SpanFromContext(ctx)
+	if !ok && len(ctxOpts) == 0 {
+		return tracer.StartSpan(operationName, opts...)
+	}
+	all := make([]ddtrace.StartSpanOption, 0, len(opts)+len(ctxOpts)+1)
+	all = append(all, opts...)
+	all = append(all, ctxOpts...)
+	if ok {
+		all = append(all, tracer.ChildOf(parent.Context()))
+	}
+	return tracer.StartSpan(operationName, all...)
+}
+
+// keepSpan reports whether span must be stored in the context for the After
+// methods of a Hook. The spans of the no-op tracer are only stored for the
+// start and finish hooks, which keeps the untraced commands from allocating.
+func (cfg *clientConfig) keepSpan(span ddtrace.Span) bool {
+	return isRecorded(span) || cfg.startHook != nil || cfg.finishHook != nil
+}
+
+// isRecorded reports whether span is recorded by a tracer, as opposed to the
+// spans of the no-op tracer used when no tracer is started, whose tags are
+// not worth computing. dd-trace-go does not expose whether a recorded span is
+// sampled out.
+func isRecorded(span ddtrace.Span) bool {
+	return span.Context().SpanID() != 0
+}
+
 // commandsToString returns a string representation of a slice of redis Commands, separated by newlines.
-func commandsToString(cmds []redis.Cmder) string {
+// If max is positive, the result is truncated to max bytes.
+func commandsToString(cmds []redis.Cmder, max int) string {
 	var b strings.Builder
 	for _, cmd := range cmds {
+		if max > 0 && b.Len() > max {
+			break
+		}
 		b.WriteString(cmd.String())
 		b.WriteString("\n")
 	}
-	return b.String()
+	return truncate(b.String(), max)
+}
+
+// commandNamesToString returns the names of a slice of redis Commands, separated by newlines.
+// If max is positive, the result is truncated to max bytes.
+func commandNamesToString(cmds []redis.Cmder, max int) string {
+	var b strings.Builder
+	for _, cmd := range cmds {
+		if max > 0 && b.Len() > max {
+			break
+		}
+		b.WriteString(cmd.Name())
+		b.WriteString("\n")
+	}
+	return truncate(b.String(), max)
+}
+
+// truncationMarker is appended to values which were truncated.
+const truncationMarker = "..."
+
+// truncate shortens s to at most max bytes, without splitting a UTF-8 sequence,
+// and appends truncationMarker. It returns s unchanged if max is not positive.
+func truncate(s string, max int) string {
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	i := max
+	for i > 0 && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return s[:i] + truncationMarker
 }
@@ -0,0 +1,86 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/go-redis/redis/v7"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// retryTags returns the tags describing the retry policy of the client, if it
+// retries commands.
+func (cfg *clientConfig) retryTags() []ddtrace.StartSpanOption {
+	if cfg.maxRetries <= 0 {
+		return nil
+	}
+	return []ddtrace.StartSpanOption{
+		tracer.Tag("redis.retry.max_retries", cfg.maxRetries),
+		tracer.Tag("redis.retry.min_backoff_ms", milliseconds(cfg.minRetryBackoff)),
+		tracer.Tag("redis.retry.max_backoff_ms", milliseconds(cfg.maxRetryBackoff)),
+	}
+}
+
+// setRetryExhausted tags span if err would have been retried by go-redis,
+// in which case the command was attempted 1+maxRetries times. go-redis does
+// not retry the network timeouts of the commands having their own timeout,
+// such as blocking commands, unless retryTimeout is true. The errors injected
+// by a FaultHook are never retried.
+func (cfg *clientConfig) setRetryExhausted(ctx context.Context, span ddtrace.Span, err error, retryTimeout bool) {
+	if cfg.maxRetries <= 0 || faultInjected(ctx) || !isRetryable(err, retryTimeout) {
+		return
+	}
+	span.SetTag("redis.retry.exhausted", true)
+	span.SetTag("redis.retry.attempts", cfg.maxRetries+1)
+}
+
+// pipelineError returns the error which made go-redis retry or fail a
+// pipeline: error replies are returned to the commands and never retried.
+func pipelineError(cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		err := cmd.Err()
+		if err == nil || err == redis.Nil {
+			continue
+		}
+		var replyErr redis.Error
+		if !errors.As(err, &replyErr) {
+			return err
+		}
+	}
+	return nil
+}
+
+// isRetryable reports whether go-redis retries a command failing with err.
+func isRetryable(err error, retryTimeout bool) bool {
+	switch err {
+	case io.EOF:
+		return true
+	case nil, redis.Nil, context.Canceled, context.DeadlineExceeded:
+		return false
+	}
+	if netErr, ok := err.(net.Error); ok {
+		if netErr.Timeout() {
+			return retryTimeout
+		}
+		return true
+	}
+	s := err.Error()
+	if s == "ERR max number of clients reached" {
+		return true
+	}
+	for _, prefix := range []string{"LOADING ", "READONLY ", "CLUSTERDOWN "} {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
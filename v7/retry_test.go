@@ -0,0 +1,131 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redis
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+
+	"github.com/johejo/dd-trace-go-redis/redistest"
+)
+
+func TestRetry(t *testing.T) {
+	opts := &redis.Options{
+		Addr:            testServer.Addr(),
+		MaxRetries:      2,
+		MinRetryBackoff: time.Millisecond,
+		MaxRetryBackoff: 2 * time.Millisecond,
+	}
+
+	t.Run("exhausted", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		requireTestServer(t)
+		testServer.SetError("get", "LOADING Redis is loading the dataset in memory")
+		defer testServer.SetError("get", "")
+		client := NewClient(opts, WithServiceName("my-redis"))
+		assert.NotNil(client.Get("test_key").Err())
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 1)
+		assert.Equal(2, spans[0].Tag("redis.retry.max_retries"))
+		assert.Equal(int64(1), spans[0].Tag("redis.retry.min_backoff_ms"))
+		assert.Equal(int64(2), spans[0].Tag("redis.retry.max_backoff_ms"))
+		assert.Equal(true, spans[0].Tag("redis.retry.exhausted"))
+		assert.Equal(3, spans[0].Tag("redis.retry.attempts"))
+	})
+
+	t.Run("not-retried", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		requireTestServer(t)
+		testServer.SetError("get", "WRONGTYPE Operation against a key holding the wrong kind of value")
+		defer testServer.SetError("get", "")
+		client := NewClient(opts, WithServiceName("my-redis"))
+		assert.NotNil(client.Get("test_key").Err())
+		client = redis.NewClient(opts)
+		client.AddHook(NewFaultHook(WithFaultError(ErrFaultTimeout)))
+		WrapClient(client, WithServiceName("my-redis"))
+		assert.Equal(ErrFaultTimeout, client.Get("test_key").Err())
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 2)
+		for _, s := range spans {
+			assert.Equal(2, s.Tag("redis.retry.max_retries"))
+			assert.Nil(s.Tag("redis.retry.exhausted"))
+			assert.Nil(s.Tag("redis.retry.attempts"))
+		}
+	})
+
+	t.Run("pipeline", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		s := redistest.StartServer(t)
+		s.Close()
+		o := *opts
+		o.Addr = s.Addr()
+		client := NewClient(&o, WithServiceName("my-redis"))
+		pipeline := client.Pipeline()
+		pipeline.Get("test_key")
+		_, err := pipeline.Exec()
+		assert.NotNil(err)
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 1)
+		assert.Equal(true, spans[0].Tag("redis.retry.exhausted"))
+		assert.Equal(3, spans[0].Tag("redis.retry.attempts"))
+	})
+
+	t.Run("fault", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		client := redis.NewClient(opts)
+		client.AddHook(NewFaultHook(WithFaultError(io.EOF)))
+		WrapClient(client, WithServiceName("my-redis"))
+		assert.Equal(io.EOF, client.Get("test_key").Err())
+		pipeline := client.Pipeline()
+		pipeline.Get("test_key")
+		_, err := pipeline.Exec()
+		assert.Equal(io.EOF, err)
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 2)
+		for _, s := range spans {
+			assert.Nil(s.Tag("redis.retry.exhausted"))
+			assert.Nil(s.Tag("redis.retry.attempts"))
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		requireTestServer(t)
+		testServer.SetError("get", "LOADING Redis is loading the dataset in memory")
+		defer testServer.SetError("get", "")
+		client := NewClient(&redis.Options{Addr: testServer.Addr()}, WithServiceName("my-redis"))
+		assert.NotNil(client.Get("test_key").Err())
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 1)
+		assert.Nil(spans[0].Tag("redis.retry.max_retries"))
+		assert.Nil(spans[0].Tag("redis.retry.exhausted"))
+	})
+}
@@ -0,0 +1,148 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redis
+
+import (
+	"github.com/go-redis/redis/v7"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// ScanIterator iterates over the elements returned by a SCAN, HSCAN, SSCAN or
+// ZSCAN command like redis.ScanIterator, within a "redis.scan" span covering
+// the whole iteration. The command fetching each page is traced as a child of
+// this span when the client is wrapped.
+//
+// The span is tagged with the pattern and the count hint of the iteration,
+// and is finished when Next returns false or Close is called, with the number
+// of pages fetched and of keys returned. The keys of HSCAN and ZSCAN are the
+// fields and the members, not their values and scores.
+type ScanIterator struct {
+	span  ddtrace.Span
+	scan  func(cursor uint64) *redis.ScanCmd
+	pairs bool // the elements are field/value or member/score pairs
+
+	page   []string
+	pos    int
+	cursor uint64
+	pages  int
+	elems  int
+	err    error
+	done   bool
+}
+
+// Scan returns a ScanIterator over the keys matching match, starting at
+// cursor, like c.Scan(cursor, match, count).Iterator(). The span of the
+// iteration is started from the context of c.
+func Scan(c *redis.Client, cursor uint64, match string, count int64, opts ...ClientOption) *ScanIterator {
+	span, c := startScanSpan(c, "scan", match, count, opts)
+	return &ScanIterator{span: span, cursor: cursor, scan: func(cursor uint64) *redis.ScanCmd {
+		return c.Scan(cursor, match, count)
+	}}
+}
+
+// HScan returns a ScanIterator over the fields and values of the hash at key,
+// like c.HScan(key, cursor, match, count).Iterator().
+func HScan(c *redis.Client, key string, cursor uint64, match string, count int64, opts ...ClientOption) *ScanIterator {
+	span, c := startScanSpan(c, "hscan", match, count, opts)
+	return &ScanIterator{span: span, pairs: true, cursor: cursor, scan: func(cursor uint64) *redis.ScanCmd {
+		return c.HScan(key, cursor, match, count)
+	}}
+}
+
+// SScan returns a ScanIterator over the members of the set at key, like
+// c.SScan(key, cursor, match, count).Iterator().
+func SScan(c *redis.Client, key string, cursor uint64, match string, count int64, opts ...ClientOption) *ScanIterator {
+	span, c := startScanSpan(c, "sscan", match, count, opts)
+	return &ScanIterator{span: span, cursor: cursor, scan: func(cursor uint64) *redis.ScanCmd {
+		return c.SScan(key, cursor, match, count)
+	}}
+}
+
+// ZScan returns a ScanIterator over the members and scores of the sorted set
+// at key, like c.ZScan(key, cursor, match, count).Iterator().
+func ZScan(c *redis.Client, key string, cursor uint64, match string, count int64, opts ...ClientOption) *ScanIterator {
+	span, c := startScanSpan(c, "zscan", match, count, opts)
+	return &ScanIterator{span: span, pairs: true, cursor: cursor, scan: func(cursor uint64) *redis.ScanCmd {
+		return c.ZScan(key, cursor, match, count)
+	}}
+}
+
+// startScanSpan starts the span of an iteration from the context of c, and
+// returns it with a client running the commands fetching the pages as its
+// children.
+func startScanSpan(c *redis.Client, command, match string, count int64, opts []ClientOption) (ddtrace.Span, *redis.Client) {
+	if skipTracing(c.Context()) {
+		return noopSpan{}, c
+	}
+	cfg := newHelperConfig(c, opts)
+	spanOpts := cfg.helperSpanOptions(ext.SpanTypeRedis, "client", command)
+	spanOpts = append(spanOpts,
+		tracer.Tag("redis.scan.pattern", match),
+		tracer.Tag("redis.scan.count", count),
+	)
+	span, ctx := tracer.StartSpanFromContext(c.Context(), "redis.scan", spanOpts...)
+	return span, c.WithContext(ctx)
+}
+
+// Next advances the iterator, fetching the next page if needed, and reports
+// whether there is an element to return with Val. When it returns false, the
+// span of the iteration is finished.
+func (it *ScanIterator) Next() bool {
+	for !it.done {
+		if it.pos < len(it.page) {
+			it.pos++
+			return true
+		}
+		if it.pages > 0 && it.cursor == 0 {
+			it.finish()
+			return false
+		}
+		keys, cursor, err := it.scan(it.cursor).Result()
+		if err != nil {
+			it.err = err
+			it.finish()
+			return false
+		}
+		it.pages++
+		it.elems += len(keys)
+		it.page, it.pos, it.cursor = keys, 0, cursor
+	}
+	return false
+}
+
+// Val returns the element at the current position of the iterator.
+func (it *ScanIterator) Val() string {
+	if it.pos == 0 || it.pos > len(it.page) {
+		return ""
+	}
+	return it.page[it.pos-1]
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (it *ScanIterator) Err() error {
+	return it.err
+}
+
+// Close finishes the span of the iteration if it was stopped before Next
+// returned false. Next returns false after Close.
+func (it *ScanIterator) Close() {
+	if !it.done {
+		it.finish()
+	}
+}
+
+func (it *ScanIterator) finish() {
+	it.done = true
+	keys := it.elems
+	if it.pairs {
+		keys /= 2
+	}
+	it.span.SetTag("redis.scan.pages", it.pages)
+	it.span.SetTag("redis.scan.keys", keys)
+	it.span.Finish(tracer.WithError(it.err))
+}
@@ -0,0 +1,79 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redis
+
+import (
+	"context"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+)
+
+type (
+	spanOptionsContextKey struct{}
+	skipTracingContextKey struct{}
+)
+
+// ContextWithSpanOptions returns a copy of ctx carrying opts, which are
+// applied to the spans of the commands and pipelines run with it, after the
+// options set by the Hook.
+func ContextWithSpanOptions(ctx context.Context, opts ...ddtrace.StartSpanOption) context.Context {
+	prev := spanOptionsFromContext(ctx)
+	all := make([]ddtrace.StartSpanOption, 0, len(prev)+len(opts))
+	all = append(all, prev...)
+	all = append(all, opts...)
+	return context.WithValue(ctx, spanOptionsContextKey{}, all)
+}
+
+func spanOptionsFromContext(ctx context.Context) []ddtrace.StartSpanOption {
+	opts, _ := ctx.Value(spanOptionsContextKey{}).([]ddtrace.StartSpanOption)
+	return opts
+}
+
+// setContextTags sets the tags of opts, the span options of a context, on
+// span, so that they take precedence over the tags set by a Hook after
+// starting it.
+func setContextTags(span ddtrace.Span, opts []ddtrace.StartSpanOption) {
+	if len(opts) == 0 {
+		return
+	}
+	var cfg ddtrace.StartSpanConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	for k, v := range cfg.Tags {
+		span.SetTag(k, v)
+	}
+}
+
+// ContextWithSkipTracing returns a copy of ctx for which the commands and
+// pipelines run with it are not traced.
+func ContextWithSkipTracing(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipTracingContextKey{}, true)
+}
+
+func skipTracing(ctx context.Context) bool {
+	skip, _ := ctx.Value(skipTracingContextKey{}).(bool)
+	return skip
+}
+
+// noopSpan is returned by the helpers which give a span to their caller when
+// tracing is skipped.
+type noopSpan struct{}
+
+var (
+	_ ddtrace.Span        = noopSpan{}
+	_ ddtrace.SpanContext = noopSpan{}
+)
+
+func (noopSpan) SetTag(key string, value interface{})              {}
+func (noopSpan) SetOperationName(operationName string)             {}
+func (noopSpan) BaggageItem(key string) string                     { return "" }
+func (noopSpan) SetBaggageItem(key, val string)                    {}
+func (noopSpan) Finish(opts ...ddtrace.FinishOption)               {}
+func (noopSpan) Context() ddtrace.SpanContext                      { return noopSpan{} }
+func (noopSpan) SpanID() uint64                                    { return 0 }
+func (noopSpan) TraceID() uint64                                   { return 0 }
+func (noopSpan) ForeachBaggageItem(handler func(k, v string) bool) {}
@@ -0,0 +1,55 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// setDeadlineTags sets the tags describing the deadline of ctx on span.
+func setDeadlineTags(ctx context.Context, span ddtrace.Span) {
+	if deadline, ok := ctx.Deadline(); ok {
+		span.SetTag("redis.deadline_remaining_ms", milliseconds(time.Until(deadline)))
+	}
+}
+
+// timeoutTags returns the tags describing the timeouts configured for the
+// client.
+func (cfg *clientConfig) timeoutTags() []ddtrace.StartSpanOption {
+	var opts []ddtrace.StartSpanOption
+	if cfg.readTimeout != 0 {
+		opts = append(opts, tracer.Tag("redis.read_timeout_ms", milliseconds(cfg.readTimeout)))
+	}
+	if cfg.writeTimeout != 0 {
+		opts = append(opts, tracer.Tag("redis.write_timeout_ms", milliseconds(cfg.writeTimeout)))
+	}
+	return opts
+}
+
+// setContextError tags span if err was caused by the cancellation or the
+// expired deadline of ctx. go-redis applies the deadline of ctx to the
+// connection, so the error may also be a network timeout.
+func setContextError(ctx context.Context, span ddtrace.Span, err error) {
+	if err == nil || err == redis.Nil {
+		return
+	}
+	switch {
+	case errors.Is(err, context.Canceled), ctx.Err() == context.Canceled:
+		span.SetTag("redis.context_canceled", true)
+	case errors.Is(err, context.DeadlineExceeded), ctx.Err() == context.DeadlineExceeded:
+		span.SetTag("redis.deadline_exceeded", true)
+	}
+}
+
+func milliseconds(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
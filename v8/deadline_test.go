@@ -0,0 +1,80 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+)
+
+func TestDeadline(t *testing.T) {
+	opts := &redis.Options{Addr: testServer.Addr(), ReadTimeout: 2 * time.Second, WriteTimeout: time.Second}
+
+	t.Run("timeouts", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		client := NewClient(opts, WithServiceName("my-redis"))
+		client.Get(ctx, "test_key")
+		client.Get(context.Background(), "test_key")
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 2)
+		remaining := spans[0].Tag("redis.deadline_remaining_ms").(int64)
+		assert.True(remaining > 0 && remaining <= 60000)
+		assert.Equal(int64(2000), spans[0].Tag("redis.read_timeout_ms"))
+		assert.Equal(int64(1000), spans[0].Tag("redis.write_timeout_ms"))
+		assert.Nil(spans[0].Tag("redis.context_canceled"))
+		assert.Nil(spans[0].Tag("redis.deadline_exceeded"))
+		assert.Nil(spans[1].Tag("redis.deadline_remaining_ms"))
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		client := NewClient(opts, WithServiceName("my-redis"))
+		assert.NotNil(client.Get(ctx, "test_key").Err())
+		pipeline := client.Pipeline()
+		pipeline.Get(ctx, "test_key")
+		_, err := pipeline.Exec(ctx)
+		assert.NotNil(err)
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 2)
+		for _, s := range spans {
+			assert.Equal(true, s.Tag("redis.context_canceled"))
+			assert.Nil(s.Tag("redis.deadline_exceeded"))
+		}
+	})
+
+	t.Run("deadline-exceeded", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+		client := NewClient(opts, WithServiceName("my-redis"))
+		assert.NotNil(client.Get(ctx, "test_key").Err())
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 1)
+		assert.Equal(true, spans[0].Tag("redis.deadline_exceeded"))
+		assert.True(spans[0].Tag("redis.deadline_remaining_ms").(int64) < 0)
+	})
+}
@@ -0,0 +1,86 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+func TestRequireParent(t *testing.T) {
+	opts := &redis.Options{Addr: testServer.Addr()}
+
+	t.Run("orphan", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		client := NewClient(opts, WithServiceName("my-redis"), WithRequireParent(true))
+		ctx := context.Background()
+		client.Get(ctx, "test_key")
+		pipeline := client.Pipeline()
+		pipeline.Get(ctx, "test_key")
+		pipeline.Exec(ctx)
+		assert.Len(mt.FinishedSpans(), 0)
+
+		root, ctx := tracer.StartSpanFromContext(ctx, "parent.span")
+		client.Get(ctx, "test_key")
+		pipeline.Get(ctx, "test_key")
+		pipeline.Exec(ctx)
+		root.Finish()
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 3)
+		for _, s := range spans[:2] {
+			assert.Equal("redis.command", s.OperationName())
+			assert.Equal(root.Context().SpanID(), s.ParentID())
+		}
+	})
+
+	t.Run("hook", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		var names []string
+		client := NewClient(opts,
+			WithServiceName("my-redis"),
+			WithRequireParent(true),
+			WithOrphanHook(func(cmd redis.Cmder, d time.Duration) {
+				assert.True(d > 0)
+				names = append(names, cmd.Name())
+			}),
+		)
+		ctx := context.Background()
+		client.Get(ctx, "test_key")
+		pipeline := client.Pipeline()
+		pipeline.Get(ctx, "test_key")
+		pipeline.Expire(ctx, "test_key", time.Hour)
+		pipeline.Exec(ctx)
+		root, ctx := tracer.StartSpanFromContext(ctx, "parent.span")
+		client.Get(ctx, "test_key")
+		root.Finish()
+
+		assert.Equal([]string{"get", "get", "expire"}, names)
+		assert.Len(mt.FinishedSpans(), 2)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		client := NewClient(opts, WithServiceName("my-redis"), WithRequireParent(false))
+		client.Get(context.Background(), "test_key")
+		assert.Len(mt.FinishedSpans(), 1)
+	})
+}
@@ -0,0 +1,241 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/go-redis/redis/v8"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// PubSub wraps a redis.PubSub so that subscriptions and received messages are traced.
+type PubSub struct {
+	*redis.PubSub
+	cfg *clientConfig
+
+	once sync.Once
+	ch   <-chan *Message
+
+	closeOnce sync.Once
+	done      chan struct{} // closed by Close
+}
+
+// Message is a message received by a PubSub, with the "redis.pubsub.receive"
+// span started for it. The caller is responsible for finishing the span once
+// the message is handled.
+type Message struct {
+	*redis.Message
+	Span ddtrace.Span
+}
+
+// Context returns a copy of ctx holding the span of m, so that the handling
+// of the message is traced as its children.
+func (m *Message) Context(ctx context.Context) context.Context {
+	return tracer.ContextWithSpan(ctx, m.Span)
+}
+
+// WrapPubSub wraps a given redis.PubSub. Use WithRedisOptions to tag the spans
+// with the address of the client which created it.
+func WrapPubSub(ps *redis.PubSub, opts ...ClientOption) *PubSub {
+	return &PubSub{
+		PubSub: ps,
+		cfg:    newClientConfig(opts...),
+		done:   make(chan struct{}),
+	}
+}
+
+// Subscribe subscribes the client to the specified channels within a
+// command span.
+func (ps *PubSub) Subscribe(ctx context.Context, channels ...string) error {
+	return ps.traceCommand(ctx, "subscribe", channels, ps.PubSub.Subscribe)
+}
+
+// PSubscribe subscribes the client to the given patterns within a
+// command span.
+func (ps *PubSub) PSubscribe(ctx context.Context, patterns ...string) error {
+	return ps.traceCommand(ctx, "psubscribe", patterns, ps.PubSub.PSubscribe)
+}
+
+func (ps *PubSub) traceCommand(ctx context.Context, name string, args []string, fn func(context.Context, ...string) error) error {
+	if skipTracing(ctx) {
+		return fn(ctx, args...)
+	}
+	opts := ps.cfg.helperSpanOptions(ext.SpanTypeRedis, "client", name)
+	if ps.cfg.rawCommand {
+		raw := name + " " + strings.Join(args, " ")
+		opts = append(opts, tracer.Tag("redis.raw_command", truncate(raw, ps.cfg.maxRawCommand)))
+	}
+	span, ctx := tracer.StartSpanFromContext(ctx, ps.cfg.commandOpName, opts...)
+	err := fn(ctx, args...)
+	span.Finish(tracer.WithError(err))
+	return err
+}
+
+// ReceiveMessage returns a message like redis.PubSub.ReceiveMessage, with a
+// "redis.pubsub.receive" span started for it from ctx, which does nothing if
+// tracing is skipped for ctx.
+func (ps *PubSub) ReceiveMessage(ctx context.Context) (*Message, error) {
+	msg, err := ps.PubSub.ReceiveMessage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ps.newMessage(ctx, msg), nil
+}
+
+// Channel returns a Go channel for concurrently receiving messages like
+// redis.PubSub.Channel, with a "redis.pubsub.receive" span started for each
+// of them. Close stops the delivery, even if the messages are not read
+// anymore, and finishes the span of the message being delivered.
+func (ps *PubSub) Channel(opts ...redis.ChannelOption) <-chan *Message {
+	ps.once.Do(func() {
+		in := ps.PubSub.Channel(opts...)
+		out := make(chan *Message)
+		ps.ch = out
+		go func() {
+			defer close(out)
+			for msg := range in {
+				m := ps.newMessage(context.Background(), msg)
+				select {
+				case out <- m:
+				case <-ps.done:
+					m.Span.Finish()
+					return
+				}
+			}
+		}()
+	})
+	return ps.ch
+}
+
+// Close closes the PubSub.
+func (ps *PubSub) Close() error {
+	ps.closeOnce.Do(func() { close(ps.done) })
+	return ps.PubSub.Close()
+}
+
+// newMessage starts the span of a received message. If the payload is an
+// envelope written by Publish, msg.Payload is replaced with the original
+// payload and the span is a child of the publishing span, otherwise of the
+// span of ctx.
+func (ps *PubSub) newMessage(ctx context.Context, msg *redis.Message) *Message {
+	var spanctx ddtrace.SpanContext
+	if ps.cfg.pubSubEnvelope {
+		if payload, sc, ok := openEnvelope(msg.Payload); ok {
+			msg.Payload = payload
+			spanctx = sc
+		}
+	}
+	if skipTracing(ctx) {
+		return &Message{Message: msg, Span: noopSpan{}}
+	}
+	opts := ps.cfg.helperSpanOptions(ext.SpanTypeMessageConsumer, "consumer", msg.Channel)
+	opts = append(opts, tracer.Tag("redis.pubsub.channel", msg.Channel))
+	if msg.Pattern != "" {
+		opts = append(opts, tracer.Tag("redis.pubsub.pattern", msg.Pattern))
+	}
+	if spanctx == nil {
+		span, _ := tracer.StartSpanFromContext(ctx, "redis.pubsub.receive", opts...)
+		return &Message{Message: msg, Span: span}
+	}
+	// the publishing span takes precedence over the span of ctx, which
+	// StartSpanFromContext would make the parent
+	opts = append(opts, tracer.ChildOf(spanctx))
+	return &Message{Message: msg, Span: tracer.StartSpan("redis.pubsub.receive", opts...)}
+}
+
+// Publish posts the message to the channel like redis.Cmdable.Publish, within
+// a "redis.pubsub.publish" span. If WithPubSubEnvelope is enabled, the message
+// is wrapped in an envelope carrying the span context, which a PubSub with
+// the same option unwraps.
+func Publish(ctx context.Context, c redis.Cmdable, channel string, message interface{}, opts ...ClientOption) *redis.IntCmd {
+	if skipTracing(ctx) {
+		return c.Publish(ctx, channel, message)
+	}
+	cfg := newHelperConfig(c, opts)
+	spanOpts := cfg.helperSpanOptions(ext.SpanTypeMessageProducer, "producer", channel)
+	spanOpts = append(spanOpts, tracer.Tag("redis.pubsub.channel", channel))
+	span, ctx := tracer.StartSpanFromContext(ctx, "redis.pubsub.publish", spanOpts...)
+	if cfg.pubSubEnvelope {
+		if env, err := sealEnvelope(span.Context(), message); err == nil {
+			message = env
+		}
+	}
+	cmd := c.Publish(ctx, channel, message)
+	span.Finish(tracer.WithError(cmd.Err()))
+	return cmd
+}
+
+var errUnsupportedPayload = errors.New("envelope payload must be a string or []byte")
+
+// envelopePrefix starts every envelope, so that other payloads can be
+// told apart without decoding them.
+const envelopePrefix = `{"_dd":`
+
+// envelope is the format of payloads published with WithPubSubEnvelope. The
+// payloads which are not valid UTF-8, which JSON strings cannot hold, are
+// stored in Data instead of Payload.
+type envelope struct {
+	Trace   tracer.TextMapCarrier `json:"_dd"`
+	Payload string                `json:"payload"`
+	Data    []byte                `json:"data,omitempty"`
+}
+
+func sealEnvelope(spanctx ddtrace.SpanContext, message interface{}) (string, error) {
+	env := envelope{Trace: make(tracer.TextMapCarrier)}
+	switch m := message.(type) {
+	case string:
+		if utf8.ValidString(m) {
+			env.Payload = m
+		} else {
+			env.Data = []byte(m)
+		}
+	case []byte:
+		if utf8.Valid(m) {
+			env.Payload = string(m)
+		} else {
+			env.Data = m
+		}
+	default:
+		return "", errUnsupportedPayload
+	}
+	if err := tracer.Inject(spanctx, env.Trace); err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(env)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// openEnvelope returns the original payload and the span context of an
+// envelope. It returns false if payload is not an envelope.
+func openEnvelope(payload string) (string, ddtrace.SpanContext, bool) {
+	if !strings.HasPrefix(payload, envelopePrefix) {
+		return "", nil, false
+	}
+	var env envelope
+	if err := json.Unmarshal([]byte(payload), &env); err != nil {
+		return "", nil, false
+	}
+	payload = env.Payload
+	if env.Data != nil {
+		payload = string(env.Data)
+	}
+	spanctx, err := tracer.Extract(env.Trace)
+	if err != nil {
+		return payload, nil, true
+	}
+	return payload, spanctx, true
+}
@@ -0,0 +1,187 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+func TestPubSub(t *testing.T) {
+	ctx := context.Background()
+	opts := &redis.Options{Addr: testServer.Addr()}
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	client := redis.NewClient(opts)
+	ps := WrapPubSub(client.Subscribe(ctx), WithServiceName("my-redis"), WithRedisOptions(opts), WithPubSubEnvelope(true))
+	assert.Nil(ps.Subscribe(ctx, "test_channel"))
+	_, err := ps.Receive(ctx)
+	assert.Nil(err)
+
+	assert.Nil(Publish(ctx, client, "test_channel", "hello", WithPubSubEnvelope(true)).Err())
+	msg, err := ps.ReceiveMessage(ctx)
+	assert.Nil(err)
+	assert.Equal("hello", msg.Payload)
+	handle, _ := tracer.StartSpanFromContext(msg.Context(context.Background()), "handle")
+	handle.Finish()
+	msg.Span.Finish()
+	assert.Nil(ps.Close())
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 4)
+	subscribe, publish, receive := spans[0], spans[1], spans[3]
+
+	assert.Equal("redis.command", subscribe.OperationName())
+	assert.Equal("subscribe", subscribe.Tag(ext.ResourceName))
+	assert.Equal("subscribe test_channel", subscribe.Tag("redis.raw_command"))
+	assert.Equal("my-redis", subscribe.Tag(ext.ServiceName))
+	assert.Equal("127.0.0.1", subscribe.Tag(ext.TargetHost))
+
+	assert.Equal("redis.pubsub.publish", publish.OperationName())
+	assert.Equal("test_channel", publish.Tag(ext.ResourceName))
+
+	assert.Equal("redis.pubsub.receive", receive.OperationName())
+	assert.Equal(ext.SpanTypeMessageConsumer, receive.Tag(ext.SpanType))
+	assert.Equal("test_channel", receive.Tag("redis.pubsub.channel"))
+	assert.Equal(publish.SpanID(), receive.ParentID())
+	assert.Equal(receive.SpanID(), spans[2].ParentID())
+}
+
+func TestPubSubReceiveParent(t *testing.T) {
+	ctx := context.Background()
+	opts := &redis.Options{Addr: testServer.Addr()}
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	client := redis.NewClient(opts)
+	ps := WrapPubSub(client.Subscribe(ctx), WithPubSubEnvelope(true))
+	assert.Nil(ps.Subscribe(ctx, "test_channel"))
+	_, err := ps.Receive(ctx)
+	assert.Nil(err)
+
+	// the publishing span takes precedence over the span of the consumer
+	worker, workerCtx := tracer.StartSpanFromContext(ctx, "worker")
+	assert.Nil(Publish(ctx, client, "test_channel", "hello", WithPubSubEnvelope(true)).Err())
+	msg, err := ps.ReceiveMessage(workerCtx)
+	assert.Nil(err)
+	msg.Span.Finish()
+	assert.Nil(client.Publish(ctx, "test_channel", "hello").Err())
+	msg, err = ps.ReceiveMessage(workerCtx)
+	assert.Nil(err)
+	msg.Span.Finish()
+	worker.Finish()
+	assert.Nil(ps.Close())
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 5)
+	publish, receive, plain := spans[1], spans[2], spans[3]
+	assert.Equal("redis.pubsub.publish", publish.OperationName())
+	assert.Equal(publish.SpanID(), receive.ParentID())
+	assert.Equal(publish.TraceID(), receive.TraceID())
+	// without an envelope, the span of the consumer is the parent
+	assert.Equal(worker.Context().SpanID(), plain.ParentID())
+}
+
+func TestPubSubChannel(t *testing.T) {
+	ctx := context.Background()
+	opts := &redis.Options{Addr: testServer.Addr()}
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	client := redis.NewClient(opts)
+	ps := WrapPubSub(client.PSubscribe(ctx, "test_*"))
+	_, err := ps.Receive(ctx)
+	assert.Nil(err)
+	ch := ps.Channel()
+
+	client.Publish(ctx, "test_a", "a")
+	client.Publish(ctx, "test_b", "b")
+	for _, payload := range []string{"a", "b"} {
+		msg := <-ch
+		assert.Equal(payload, msg.Payload)
+		msg.Span.Finish()
+	}
+	assert.Nil(ps.Close())
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 2)
+	assert.Equal("test_a", spans[0].Tag(ext.ResourceName))
+	assert.Equal("test_*", spans[0].Tag("redis.pubsub.pattern"))
+	assert.Equal("test_b", spans[1].Tag(ext.ResourceName))
+}
+
+func TestPubSubChannelClose(t *testing.T) {
+	ctx := context.Background()
+	opts := &redis.Options{Addr: testServer.Addr()}
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	client := redis.NewClient(opts)
+	ps := WrapPubSub(client.PSubscribe(ctx, "test_*"))
+	_, err := ps.Receive(ctx)
+	assert.Nil(err)
+	ch := ps.Channel()
+
+	client.Publish(ctx, "test_a", "a")
+	client.Publish(ctx, "test_b", "b")
+	msg := <-ch
+	assert.Equal("a", msg.Payload)
+	msg.Span.Finish()
+	// stop reading while the second message is being delivered
+	assert.Eventually(func() bool { return len(mt.OpenSpans()) == 1 }, time.Second, time.Millisecond)
+	assert.Nil(ps.Close())
+
+	assert.Eventually(func() bool { return len(mt.FinishedSpans()) == 2 }, time.Second, 10*time.Millisecond)
+	_, ok := <-ch
+	assert.False(ok)
+}
+
+func TestEnvelope(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	span := tracer.StartSpan("test")
+	env, err := sealEnvelope(span.Context(), []byte("hello"))
+	assert.Nil(err)
+	payload, spanctx, ok := openEnvelope(env)
+	assert.True(ok)
+	assert.Equal("hello", payload)
+	assert.Equal(span.Context().SpanID(), spanctx.SpanID())
+
+	// JSON strings cannot hold binary payloads
+	binary := []byte{0xff, 0x00, 0xfe, 'a'}
+	env, err = sealEnvelope(span.Context(), binary)
+	assert.Nil(err)
+	payload, spanctx, ok = openEnvelope(env)
+	assert.True(ok)
+	assert.Equal(string(binary), payload)
+	assert.Equal(span.Context().SpanID(), spanctx.SpanID())
+	env, err = sealEnvelope(span.Context(), string(binary))
+	assert.Nil(err)
+	payload, _, _ = openEnvelope(env)
+	assert.Equal(string(binary), payload)
+
+	_, err = sealEnvelope(span.Context(), 1)
+	assert.Equal(errUnsupportedPayload, err)
+
+	_, _, ok = openEnvelope("hello")
+	assert.False(ok)
+	_, _, ok = openEnvelope(`{"_dd":`)
+	assert.False(ok)
+}
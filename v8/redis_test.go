@@ -7,22 +7,78 @@ package redis
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 
 	"github.com/johejo/dd-trace-go-redis/internal/globalconfig"
+	"github.com/johejo/dd-trace-go-redis/redistest"
 )
 
+// testServer is the Redis server the tests run against: the server at
+// REDIS_ADDR if set, such as the one of docker-compose.yaml, or an
+// in-process redistest.Server.
+var testServer *testRedis
+
+type testRedis struct {
+	addr string
+	srv  *redistest.Server // nil when running against REDIS_ADDR
+}
+
+func (r *testRedis) Addr() string {
+	return r.addr
+}
+
+func (r *testRedis) Port() string {
+	_, port, _ := net.SplitHostPort(r.addr)
+	return port
+}
+
+// SetError calls redistest.Server.SetError. The tests calling it must call
+// requireTestServer first.
+func (r *testRedis) SetError(command, msg string) {
+	r.srv.SetError(command, msg)
+}
+
+// requireTestServer skips t if the tests do not run against a
+// redistest.Server.
+func requireTestServer(t *testing.T) {
+	if testServer.srv == nil {
+		t.Skip("requires redistest.Server, REDIS_ADDR is set")
+	}
+}
+
+func TestMain(m *testing.M) {
+	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
+		testServer = &testRedis{addr: addr}
+		os.Exit(m.Run())
+	}
+	srv, err := redistest.NewServer()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	testServer = &testRedis{addr: srv.Addr(), srv: srv}
+	code := m.Run()
+	srv.Close()
+	os.Exit(code)
+}
+
 func TestClientEvalSha(t *testing.T) {
 	ctx := context.Background()
-	opts := &redis.Options{Addr: "127.0.0.1:6379"}
+	opts := &redis.Options{Addr: testServer.Addr()}
 	assert := assert.New(t)
 	mt := mocktracer.Start()
 	defer mt.Stop()
@@ -42,14 +98,14 @@ func TestClientEvalSha(t *testing.T) {
 	assert.Equal(ext.SpanTypeRedis, span.Tag(ext.SpanType))
 	assert.Equal("my-redis", span.Tag(ext.ServiceName))
 	assert.Equal("127.0.0.1", span.Tag(ext.TargetHost))
-	assert.Equal("6379", span.Tag(ext.TargetPort))
+	assert.Equal(testServer.Port(), span.Tag(ext.TargetPort))
 	assert.Equal("evalsha", span.Tag(ext.ResourceName))
 }
 
 // https://github.com/DataDog/dd-trace-go/issues/387
 func TestIssue387(t *testing.T) {
 	ctx := context.Background()
-	opts := &redis.Options{Addr: "127.0.0.1:6379"}
+	opts := &redis.Options{Addr: testServer.Addr()}
 	client := NewClient(opts, WithServiceName("my-redis"))
 	n := 1000
 
@@ -71,7 +127,7 @@ func TestIssue387(t *testing.T) {
 
 func TestClient(t *testing.T) {
 	ctx := context.Background()
-	opts := &redis.Options{Addr: "127.0.0.1:6379"}
+	opts := &redis.Options{Addr: testServer.Addr()}
 	assert := assert.New(t)
 	mt := mocktracer.Start()
 	defer mt.Stop()
@@ -87,14 +143,14 @@ func TestClient(t *testing.T) {
 	assert.Equal(ext.SpanTypeRedis, span.Tag(ext.SpanType))
 	assert.Equal("my-redis", span.Tag(ext.ServiceName))
 	assert.Equal("127.0.0.1", span.Tag(ext.TargetHost))
-	assert.Equal("6379", span.Tag(ext.TargetPort))
+	assert.Equal(testServer.Port(), span.Tag(ext.TargetPort))
 	assert.Equal("set test_key test_value: ", span.Tag("redis.raw_command"))
 	assert.Equal("3", span.Tag("redis.args_length"))
 }
 
 func TestPipeline(t *testing.T) {
 	ctx := context.Background()
-	opts := &redis.Options{Addr: "127.0.0.1:6379"}
+	opts := &redis.Options{Addr: testServer.Addr()}
 	assert := assert.New(t)
 	mt := mocktracer.Start()
 	defer mt.Stop()
@@ -117,7 +173,7 @@ func TestPipeline(t *testing.T) {
 	assert.Equal("my-redis", span.Tag(ext.ServiceName))
 	assert.Equal("expire pipeline_counter 3600: false\n", span.Tag(ext.ResourceName))
 	assert.Equal("127.0.0.1", span.Tag(ext.TargetHost))
-	assert.Equal("6379", span.Tag(ext.TargetPort))
+	assert.Equal(testServer.Port(), span.Tag(ext.TargetPort))
 	assert.Equal("1", span.Tag("redis.pipeline_length"))
 
 	mt.Reset()
@@ -140,7 +196,7 @@ func TestPipeline(t *testing.T) {
 }
 
 func TestChildSpan(t *testing.T) {
-	opts := &redis.Options{Addr: "127.0.0.1:6379"}
+	opts := &redis.Options{Addr: testServer.Addr()}
 	assert := assert.New(t)
 	mt := mocktracer.Start()
 	defer mt.Stop()
@@ -169,12 +225,12 @@ func TestChildSpan(t *testing.T) {
 
 	assert.Equal(child.ParentID(), parent.SpanID())
 	assert.Equal(child.Tag(ext.TargetHost), "127.0.0.1")
-	assert.Equal(child.Tag(ext.TargetPort), "6379")
+	assert.Equal(child.Tag(ext.TargetPort), testServer.Port())
 }
 
 func TestMultipleCommands(t *testing.T) {
 	ctx := context.Background()
-	opts := &redis.Options{Addr: "127.0.0.1:6379"}
+	opts := &redis.Options{Addr: testServer.Addr()}
 	assert := assert.New(t)
 	mt := mocktracer.Start()
 	defer mt.Stop()
@@ -224,7 +280,7 @@ func TestError(t *testing.T) {
 
 	t.Run("nil", func(t *testing.T) {
 		ctx := context.Background()
-		opts := &redis.Options{Addr: "127.0.0.1:6379"}
+		opts := &redis.Options{Addr: testServer.Addr()}
 		assert := assert.New(t)
 		mt := mocktracer.Start()
 		defer mt.Stop()
@@ -240,7 +296,7 @@ func TestError(t *testing.T) {
 		assert.Equal("redis.command", span.OperationName())
 		assert.Empty(span.Tag(ext.Error))
 		assert.Equal("127.0.0.1", span.Tag(ext.TargetHost))
-		assert.Equal("6379", span.Tag(ext.TargetPort))
+		assert.Equal(testServer.Port(), span.Tag(ext.TargetPort))
 		assert.Equal("get non_existent_key: ", span.Tag("redis.raw_command"))
 	})
 }
@@ -248,7 +304,7 @@ func TestError(t *testing.T) {
 func TestAnalyticsSettings(t *testing.T) {
 	ctx := context.Background()
 	assertRate := func(t *testing.T, mt mocktracer.Tracer, rate interface{}, opts ...ClientOption) {
-		client := NewClient(&redis.Options{Addr: "127.0.0.1:6379"}, opts...)
+		client := NewClient(&redis.Options{Addr: testServer.Addr()}, opts...)
 		client.Set(ctx, "test_key", "test_value", 0)
 		pipeline := client.Pipeline()
 		pipeline.Expire(ctx, "pipeline_counter", time.Hour)
@@ -315,7 +371,7 @@ func TestAnalyticsSettings(t *testing.T) {
 }
 
 func TestWithContext(t *testing.T) {
-	opts := &redis.Options{Addr: "127.0.0.1:6379"}
+	opts := &redis.Options{Addr: testServer.Addr()}
 	assert := assert.New(t)
 	mt := mocktracer.Start()
 	defer mt.Stop()
@@ -354,3 +410,550 @@ func TestWithContext(t *testing.T) {
 	assert.Equal(span1.SpanID(), setSpan.ParentID())
 	assert.Equal(span2.SpanID(), getSpan.ParentID())
 }
+
+func TestRawCommand(t *testing.T) {
+	ctx := context.Background()
+	opts := &redis.Options{Addr: testServer.Addr()}
+
+	t.Run("max-length", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		client := NewClient(opts, WithServiceName("my-redis"), WithMaxRawCommandLength(10))
+		client.Set(ctx, "test_key", "test_value", 0)
+		pipeline := client.Pipeline()
+		pipeline.Expire(ctx, "pipeline_counter", time.Hour)
+		_, err := pipeline.Exec(ctx)
+		assert.Nil(err)
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 2)
+		assert.Equal("set test_k...", spans[0].Tag("redis.raw_command"))
+		assert.Equal("3", spans[0].Tag("redis.args_length"))
+		assert.Equal("expire pip...", spans[1].Tag("redis.raw_command"))
+		assert.Equal("expire pip...", spans[1].Tag(ext.ResourceName))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		client := NewClient(opts, WithServiceName("my-redis"), WithRawCommand(false))
+		client.Set(ctx, "test_key", "test_value", 0)
+		pipeline := client.Pipeline()
+		pipeline.Expire(ctx, "pipeline_counter", time.Hour)
+		pipeline.Get(ctx, "test_key")
+		_, err := pipeline.Exec(ctx)
+		assert.Nil(err)
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 2)
+		assert.Nil(spans[0].Tag("redis.raw_command"))
+		assert.Equal("set", spans[0].Tag(ext.ResourceName))
+		assert.Nil(spans[1].Tag("redis.raw_command"))
+		assert.Equal("expire\nget\n", spans[1].Tag(ext.ResourceName))
+	})
+
+	t.Run("disabled-max-length", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		client := NewClient(opts, WithServiceName("my-redis"), WithRawCommand(false), WithMaxRawCommandLength(10))
+		pipeline := client.Pipeline()
+		for i := 0; i < 100; i++ {
+			pipeline.Set(ctx, "test_key", "test_value", 0)
+		}
+		_, err := pipeline.Exec(ctx)
+		assert.Nil(err)
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 1)
+		assert.Nil(spans[0].Tag("redis.raw_command"))
+		assert.Equal("set\nset\nse...", spans[0].Tag(ext.ResourceName))
+	})
+}
+
+func TestTruncate(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("get key", truncate("get key", 0))
+	assert.Equal("get key", truncate("get key", 7))
+	assert.Equal("get...", truncate("get key", 3))
+	assert.Equal("get ...", truncate("get 日本", 5))
+}
+
+func TestSpanHooks(t *testing.T) {
+	ctx := context.Background()
+	opts := &redis.Options{Addr: testServer.Addr()}
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	client := NewClient(opts,
+		WithServiceName("my-redis"),
+		WithSpanStartHook(func(span ddtrace.Span, cmd redis.Cmder) {
+			if key, ok := cmd.Args()[1].(string); ok {
+				span.SetTag("tenant", strings.SplitN(key, ":", 2)[0])
+			}
+		}),
+		WithSpanFinishHook(func(span ddtrace.Span, cmd redis.Cmder) {
+			if c, ok := cmd.(*redis.StringSliceCmd); ok {
+				span.SetTag("result.length", len(c.Val()))
+			}
+		}),
+	)
+	client.Del(ctx, "acme:list")
+	mt.Reset()
+	client.RPush(ctx, "acme:list", "a", "b")
+	client.LRange(ctx, "acme:list", 0, -1)
+	pipeline := client.Pipeline()
+	pipeline.LRange(ctx, "initech:list", 0, -1)
+	_, err := pipeline.Exec(ctx)
+	assert.Nil(err)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 3)
+	assert.Equal("acme", spans[0].Tag("tenant"))
+	assert.Nil(spans[0].Tag("result.length"))
+	assert.Equal("acme", spans[1].Tag("tenant"))
+	assert.Equal(2, spans[1].Tag("result.length"))
+	assert.Equal("initech", spans[2].Tag("tenant"))
+	assert.Equal(0, spans[2].Tag("result.length"))
+}
+
+func TestStandardTags(t *testing.T) {
+	ctx := context.Background()
+	assertTags := func(t *testing.T, peerService interface{}, opts ...ClientOption) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		client := NewClient(&redis.Options{Addr: testServer.Addr(), DB: 1}, opts...)
+		client.Get(ctx, "test_key")
+		pipeline := client.Pipeline()
+		pipeline.Expire(ctx, "pipeline_counter", time.Hour)
+		_, err := pipeline.Exec(ctx)
+		assert.Nil(t, err)
+
+		spans := mt.FinishedSpans()
+		assert.Len(t, spans, 2)
+		for _, s := range spans {
+			assert.Equal(t, "go-redis/redis.v8", s.Tag("component"))
+			assert.Equal(t, "client", s.Tag("span.kind"))
+			assert.Equal(t, "redis", s.Tag("db.system"))
+			assert.Equal(t, "1", s.Tag(ext.DBInstance))
+			assert.Equal(t, peerService, s.Tag(ext.PeerService))
+		}
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		assertTags(t, nil)
+	})
+
+	t.Run("peer-service", func(t *testing.T) {
+		assertTags(t, "session-store", WithPeerService("session-store"))
+	})
+}
+
+func TestOperationNames(t *testing.T) {
+	ctx := context.Background()
+	opts := &redis.Options{Addr: testServer.Addr()}
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	client := NewClient(opts,
+		WithMeasured(true),
+		WithOperationName("redis.cmd"),
+		WithPipelineOperationName("redis.pipeline"),
+	)
+	client.Get(ctx, "test_key")
+	pipeline := client.Pipeline()
+	pipeline.Expire(ctx, "pipeline_counter", time.Hour)
+	_, err := pipeline.Exec(ctx)
+	assert.Nil(err)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 2)
+	assert.Equal("redis.cmd", spans[0].OperationName())
+	assert.Equal("redis.pipeline", spans[1].OperationName())
+	for _, s := range spans {
+		assert.Equal(1, s.Tag("_dd.measured"))
+	}
+
+	mt.Reset()
+	client = NewClient(opts)
+	client.Get(ctx, "test_key")
+	spans = mt.FinishedSpans()
+	assert.Len(spans, 1)
+	assert.Nil(spans[0].Tag("_dd.measured"))
+}
+
+// shortCircuitHook fails every command before it is processed.
+type shortCircuitHook struct{}
+
+func (shortCircuitHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, errors.New("short-circuited")
+}
+
+func (shortCircuitHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (shortCircuitHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, errors.New("short-circuited")
+}
+
+func (shortCircuitHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+func TestHookChain(t *testing.T) {
+	ctx := context.Background()
+	opts := &redis.Options{Addr: testServer.Addr()}
+
+	t.Run("stacked", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		first := NewHook(WithServiceName("first"))
+		client := redis.NewClient(opts)
+		client.AddHook(first)
+		client.AddHook(NewHook(WithServiceName("second")))
+		client.Get(ctx, "hook_chain_key")
+		pipeline := client.Pipeline()
+		pipeline.Get(ctx, "hook_chain_key")
+		_, err := pipeline.Exec(ctx)
+		assert.Equal(redis.Nil, err)
+
+		// the commands traced by the first Hook are skipped by the second one
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 2)
+		for _, s := range spans {
+			assert.Equal("first", s.Tag(ext.ServiceName))
+		}
+
+		// nor are the commands skipped by the first Hook
+		mt.Reset()
+		first.SetEnabled(false)
+		client.Get(ctx, "hook_chain_key")
+		assert.Len(mt.FinishedSpans(), 0)
+	})
+
+	t.Run("short-circuit", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		client := redis.NewClient(opts)
+		client.AddHook(shortCircuitHook{})
+		WrapClient(client, WithServiceName("my-redis"))
+		root, ctx := tracer.StartSpanFromContext(ctx, "parent.span")
+		err := client.Get(ctx, "test_key").Err()
+		assert.EqualError(err, "short-circuited")
+		assert.Len(mt.FinishedSpans(), 0)
+		root.Finish()
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 1)
+		assert.Equal("parent.span", spans[0].OperationName())
+	})
+
+	t.Run("after-without-before", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		hook := NewHook(WithServiceName("my-redis"))
+		root, ctx := tracer.StartSpanFromContext(ctx, "parent.span")
+		cmd := redis.NewStringCmd(ctx, "get", "test_key")
+		hook.AfterProcess(ctx, cmd)
+		hook.AfterProcessPipeline(ctx, []redis.Cmder{cmd})
+		assert.Len(mt.FinishedSpans(), 0)
+		root.Finish()
+		assert.Len(mt.FinishedSpans(), 1)
+	})
+}
+
+func TestHookConfigure(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+	ctx := context.Background()
+
+	h := NewHook(WithServiceName("before"))
+	client := redis.NewClient(&redis.Options{Addr: testServer.Addr()})
+	client.AddHook(h)
+	client.Get(ctx, "test_key")
+
+	// a command in flight finishes with the configuration it started with
+	cmd := redis.NewStringCmd(ctx, "get", "test_key")
+	cmdCtx, _ := h.BeforeProcess(ctx, cmd)
+	h.configure(newClientConfig(
+		WithServiceName("after"),
+		WithAnalyticsRate(0.5),
+		WithSpanFinishHook(func(span ddtrace.Span, _ redis.Cmder) {
+			span.SetTag("finish_hook", true)
+		}),
+	))
+	h.AfterProcess(cmdCtx, cmd)
+	client.Get(ctx, "test_key")
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 3)
+	assert.Equal("before", spans[0].Tag(ext.ServiceName))
+	assert.Nil(spans[0].Tag(ext.EventSampleRate))
+	assert.Equal("before", spans[1].Tag(ext.ServiceName))
+	assert.Nil(spans[1].Tag("finish_hook"))
+	assert.Equal("after", spans[2].Tag(ext.ServiceName))
+	assert.Equal(0.5, spans[2].Tag(ext.EventSampleRate))
+	assert.Equal(true, spans[2].Tag("finish_hook"))
+}
+
+func TestHookSetEnabled(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+	ctx := context.Background()
+
+	h := NewHook(WithServiceName("my-redis"))
+	client := redis.NewClient(&redis.Options{Addr: testServer.Addr()})
+	client.AddHook(h)
+	assert.True(h.Enabled())
+
+	// a command in flight is finished normally
+	cmd := redis.NewStringCmd(ctx, "get", "test_key")
+	cmdCtx, _ := h.BeforeProcess(ctx, cmd)
+	h.SetEnabled(false)
+	assert.False(h.Enabled())
+	h.AfterProcess(cmdCtx, cmd)
+	client.Get(ctx, "test_key")
+	pipeline := client.Pipeline()
+	pipeline.Get(ctx, "test_key")
+	pipeline.Exec(ctx)
+	assert.Len(mt.FinishedSpans(), 1)
+
+	h.SetEnabled(true)
+	client.Get(ctx, "test_key")
+	assert.Len(mt.FinishedSpans(), 2)
+}
+
+func TestHookUpdate(t *testing.T) {
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+	ctx := context.Background()
+
+	h := NewHook(WithRedisOptions(&redis.Options{Addr: testServer.Addr()}), WithServiceName("before"))
+	client := redis.NewClient(&redis.Options{Addr: testServer.Addr()})
+	client.AddHook(h)
+	client.Get(ctx, "test_key")
+	h.Update(WithServiceName("after"), WithAnalyticsRate(0.5))
+	client.Get(ctx, "test_key")
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 2)
+	assert.Equal("before", spans[0].Tag(ext.ServiceName))
+	assert.Nil(spans[0].Tag(ext.EventSampleRate))
+	assert.Equal("after", spans[1].Tag(ext.ServiceName))
+	assert.Equal(0.5, spans[1].Tag(ext.EventSampleRate))
+	// the other options are kept
+	assert.Equal(testServer.Port(), spans[1].Tag(ext.TargetPort))
+}
+
+func TestHookUpdateConcurrently(t *testing.T) {
+	ctx := context.Background()
+	h := NewHook(WithServiceName("my-redis"), WithIgnoredErrorClass(ErrorClassTimeout, "get"))
+	client := redis.NewClient(&redis.Options{Addr: testServer.Addr()})
+	client.AddHook(h)
+	n := 1000
+
+	client.Set(ctx, "test_key", "test_value", 0)
+
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			switch i % 10 {
+			case 0:
+				h.SetEnabled(i%20 == 0)
+			case 1:
+				h.Update(
+					WithServiceName(fmt.Sprintf("my-redis-%d", i)),
+					WithAnalyticsRate(0.5),
+					WithIgnoredErrorClass(ErrorClassTimeout, "set"),
+				)
+			default:
+				_, err := client.Get(ctx, "test_key").Result()
+				assert.Nil(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// should not result in a race
+}
+
+func TestWrapClientTwice(t *testing.T) {
+	ctx := context.Background()
+	opts := &redis.Options{Addr: testServer.Addr()}
+
+	t.Run("traced", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		client := NewClient(opts, WithServiceName("library"), WithAnalytics(true))
+		assert.Equal(client, WrapClient(client, WithServiceName("app")))
+		client.Get(ctx, "test_key")
+		pipeline := client.Pipeline()
+		pipeline.Expire(ctx, "pipeline_counter", time.Hour)
+		_, err := pipeline.Exec(ctx)
+		assert.Nil(err)
+
+		// the commands are only traced by the Hook added first
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 2)
+		assert.Equal("get", spans[0].Tag(ext.ResourceName))
+		assert.Equal("1", spans[1].Tag("redis.pipeline_length"))
+		for _, s := range spans {
+			assert.Equal("library", s.Tag(ext.ServiceName))
+			assert.Equal(1.0, s.Tag(ext.EventSampleRate))
+			assert.Zero(s.ParentID())
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		first := NewHook(WithRedisOptions(opts), WithServiceName("library"))
+		first.SetEnabled(false)
+		client := redis.NewClient(opts)
+		client.AddHook(first)
+		WrapClient(client, WithServiceName("app"))
+		client.Get(ctx, "test_key")
+		pipeline := client.Pipeline()
+		pipeline.Expire(ctx, "pipeline_counter", time.Hour)
+		_, err := pipeline.Exec(ctx)
+		assert.Nil(err)
+
+		assert.Len(mt.FinishedSpans(), 0)
+	})
+
+	t.Run("require-parent", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		client := NewClient(opts, WithServiceName("library"), WithRequireParent(true))
+		WrapClient(client, WithServiceName("app"))
+		client.Get(ctx, "test_key")
+		pipeline := client.Pipeline()
+		pipeline.Expire(ctx, "pipeline_counter", time.Hour)
+		_, err := pipeline.Exec(ctx)
+		assert.Nil(err)
+
+		assert.Len(mt.FinishedSpans(), 0)
+
+		root, parentCtx := tracer.StartSpanFromContext(ctx, "parent.span")
+		client.Get(parentCtx, "test_key")
+		root.Finish()
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 2)
+		assert.Equal("library", spans[0].Tag(ext.ServiceName))
+		assert.Equal(root.Context().SpanID(), spans[0].ParentID())
+	})
+}
+
+// benchmarkCommands returns a GET command and a pipeline of n GET commands.
+func benchmarkCommands(n int) (redis.Cmder, []redis.Cmder) {
+	ctx := context.Background()
+	cmds := make([]redis.Cmder, n)
+	for i := range cmds {
+		cmds[i] = redis.NewStringCmd(ctx, "get", fmt.Sprintf("key:%d", i))
+	}
+	return redis.NewStringCmd(ctx, "get", "key"), cmds
+}
+
+// runHook runs the hooks of h around cmd.
+func runHook(h *Hook, cmd redis.Cmder) {
+	ctx, _ := h.BeforeProcess(context.Background(), cmd)
+	h.AfterProcess(ctx, cmd)
+}
+
+// runPipelineHook runs the pipeline hooks of h around cmds.
+func runPipelineHook(h *Hook, cmds []redis.Cmder) {
+	ctx, _ := h.BeforeProcessPipeline(context.Background(), cmds)
+	h.AfterProcessPipeline(ctx, cmds)
+}
+
+// raceEnabled reports whether the race detector, which changes the
+// allocations, is enabled.
+var raceEnabled bool
+
+func TestHookAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations are not representative with the race detector")
+	}
+	h := NewHook(WithRedisOptions(&redis.Options{Addr: testServer.Addr()}))
+	cmd, cmds := benchmarkCommands(1000)
+	for _, tt := range []struct {
+		name   string
+		traced bool
+		fn     func()
+		budget float64
+	}{
+		// Without a tracer, the spans are neither tagged nor stored.
+		{"command", false, func() { runHook(h, cmd) }, 0},
+		{"pipeline-1000", false, func() { runPipelineHook(h, cmds) }, 0},
+		// With a tracer, each command of a pipeline is formatted once.
+		{"traced/command", true, func() { runHook(h, cmd) }, 30},
+		{"traced/pipeline-1000", true, func() { runPipelineHook(h, cmds) }, 1050},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.traced {
+				mt := mocktracer.Start()
+				defer mt.Stop()
+			}
+			allocs := testing.AllocsPerRun(100, tt.fn)
+			assert.True(t, allocs <= tt.budget, "%v allocations, want at most %v", allocs, tt.budget)
+		})
+	}
+}
+
+func BenchmarkHook(b *testing.B) {
+	h := NewHook(WithRedisOptions(&redis.Options{Addr: testServer.Addr()}))
+	cmd, cmds := benchmarkCommands(1000)
+	run := func(b *testing.B, fn func()) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			fn()
+		}
+	}
+	b.Run("command", func(b *testing.B) {
+		run(b, func() { runHook(h, cmd) })
+	})
+	b.Run("pipeline-1000", func(b *testing.B) {
+		run(b, func() { runPipelineHook(h, cmds) })
+	})
+
+	mt := mocktracer.Start()
+	defer mt.Stop()
+	b.Run("traced/command", func(b *testing.B) {
+		run(b, func() {
+			runHook(h, cmd)
+			mt.Reset()
+		})
+	})
+	b.Run("traced/pipeline-1000", func(b *testing.B) {
+		run(b, func() {
+			runPipelineHook(h, cmds)
+			mt.Reset()
+		})
+	})
+}
@@ -0,0 +1,153 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redis
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// ScanIterator iterates over the elements returned by a SCAN, HSCAN, SSCAN or
+// ZSCAN command like redis.ScanIterator, within a "redis.scan" span covering
+// the whole iteration. The command fetching each page is traced as a child of
+// this span when the client is wrapped.
+//
+// The span is tagged with the pattern and the count hint of the iteration,
+// and is finished when Next returns false or Close is called, with the number
+// of pages fetched and of keys returned. The keys of HSCAN and ZSCAN are the
+// fields and the members, not their values and scores.
+type ScanIterator struct {
+	span  ddtrace.Span
+	scan  func(ctx context.Context, cursor uint64) *redis.ScanCmd
+	pairs bool // the elements are field/value or member/score pairs
+	skip  bool // the iteration is not traced
+
+	page   []string
+	pos    int
+	cursor uint64
+	pages  int
+	elems  int
+	err    error
+	done   bool
+}
+
+// Scan returns a ScanIterator over the keys matching match, starting at
+// cursor, like redis.Cmdable.Scan(ctx, cursor, match, count).Iterator().
+func Scan(ctx context.Context, c redis.Cmdable, cursor uint64, match string, count int64, opts ...ClientOption) *ScanIterator {
+	return newScanIterator(ctx, c, "scan", cursor, match, count, false, opts, func(ctx context.Context, cursor uint64) *redis.ScanCmd {
+		return c.Scan(ctx, cursor, match, count)
+	})
+}
+
+// HScan returns a ScanIterator over the fields and values of the hash at key,
+// like redis.Cmdable.HScan(ctx, key, cursor, match, count).Iterator().
+func HScan(ctx context.Context, c redis.Cmdable, key string, cursor uint64, match string, count int64, opts ...ClientOption) *ScanIterator {
+	return newScanIterator(ctx, c, "hscan", cursor, match, count, true, opts, func(ctx context.Context, cursor uint64) *redis.ScanCmd {
+		return c.HScan(ctx, key, cursor, match, count)
+	})
+}
+
+// SScan returns a ScanIterator over the members of the set at key, like
+// redis.Cmdable.SScan(ctx, key, cursor, match, count).Iterator().
+func SScan(ctx context.Context, c redis.Cmdable, key string, cursor uint64, match string, count int64, opts ...ClientOption) *ScanIterator {
+	return newScanIterator(ctx, c, "sscan", cursor, match, count, false, opts, func(ctx context.Context, cursor uint64) *redis.ScanCmd {
+		return c.SScan(ctx, key, cursor, match, count)
+	})
+}
+
+// ZScan returns a ScanIterator over the members and scores of the sorted set
+// at key, like redis.Cmdable.ZScan(ctx, key, cursor, match, count).Iterator().
+func ZScan(ctx context.Context, c redis.Cmdable, key string, cursor uint64, match string, count int64, opts ...ClientOption) *ScanIterator {
+	return newScanIterator(ctx, c, "zscan", cursor, match, count, true, opts, func(ctx context.Context, cursor uint64) *redis.ScanCmd {
+		return c.ZScan(ctx, key, cursor, match, count)
+	})
+}
+
+func newScanIterator(ctx context.Context, c redis.Cmdable, command string, cursor uint64, match string, count int64, pairs bool, opts []ClientOption, scan func(context.Context, uint64) *redis.ScanCmd) *ScanIterator {
+	it := &ScanIterator{scan: scan, pairs: pairs, cursor: cursor}
+	if skipTracing(ctx) {
+		it.span, it.skip = noopSpan{}, true
+		return it
+	}
+	cfg := newHelperConfig(c, opts)
+	spanOpts := cfg.helperSpanOptions(ext.SpanTypeRedis, "client", command)
+	spanOpts = append(spanOpts,
+		tracer.Tag("redis.scan.pattern", match),
+		tracer.Tag("redis.scan.count", count),
+	)
+	it.span, _ = tracer.StartSpanFromContext(ctx, "redis.scan", spanOpts...)
+	return it
+}
+
+// Next advances the iterator, fetching the next page with ctx if needed, and
+// reports whether there is an element to return with Val. When it returns
+// false, the span of the iteration is finished.
+func (it *ScanIterator) Next(ctx context.Context) bool {
+	for !it.done {
+		if it.pos < len(it.page) {
+			it.pos++
+			return true
+		}
+		if it.pages > 0 && it.cursor == 0 {
+			it.finish()
+			return false
+		}
+		keys, cursor, err := it.scan(it.pageContext(ctx), it.cursor).Result()
+		if err != nil {
+			it.err = err
+			it.finish()
+			return false
+		}
+		it.pages++
+		it.elems += len(keys)
+		it.page, it.pos, it.cursor = keys, 0, cursor
+	}
+	return false
+}
+
+// pageContext returns the context of the command fetching a page.
+func (it *ScanIterator) pageContext(ctx context.Context) context.Context {
+	if it.skip {
+		return ContextWithSkipTracing(ctx)
+	}
+	return tracer.ContextWithSpan(ctx, it.span)
+}
+
+// Val returns the element at the current position of the iterator.
+func (it *ScanIterator) Val() string {
+	if it.pos == 0 || it.pos > len(it.page) {
+		return ""
+	}
+	return it.page[it.pos-1]
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (it *ScanIterator) Err() error {
+	return it.err
+}
+
+// Close finishes the span of the iteration if it was stopped before Next
+// returned false. Next returns false after Close.
+func (it *ScanIterator) Close() {
+	if !it.done {
+		it.finish()
+	}
+}
+
+func (it *ScanIterator) finish() {
+	it.done = true
+	keys := it.elems
+	if it.pairs {
+		keys /= 2
+	}
+	it.span.SetTag("redis.scan.pages", it.pages)
+	it.span.SetTag("redis.scan.keys", keys)
+	it.span.Finish(tracer.WithError(it.err))
+}
@@ -0,0 +1,134 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redis
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+)
+
+func TestScan(t *testing.T) {
+	ctx := context.Background()
+	opts := &redis.Options{Addr: testServer.Addr()}
+
+	t.Run("scan", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		client := NewClient(opts, WithServiceName("my-redis"))
+		for i := 0; i < 5; i++ {
+			client.Set(ctx, fmt.Sprintf("scan_key:%d", i), "value", 0)
+		}
+		mt.Reset()
+
+		var keys []string
+		iter := Scan(ctx, client, 0, "scan_key:*", 2, WithServiceName("my-redis"))
+		for iter.Next(ctx) {
+			keys = append(keys, iter.Val())
+		}
+		assert.Nil(iter.Err())
+		assert.ElementsMatch([]string{"scan_key:0", "scan_key:1", "scan_key:2", "scan_key:3", "scan_key:4"}, keys)
+
+		spans := mt.FinishedSpans()
+		parent := spans[len(spans)-1]
+		assert.Equal("redis.scan", parent.OperationName())
+		assert.Equal(ext.SpanTypeRedis, parent.Tag(ext.SpanType))
+		assert.Equal("my-redis", parent.Tag(ext.ServiceName))
+		assert.Equal("scan", parent.Tag(ext.ResourceName))
+		assert.Equal(componentName, parent.Tag("component"))
+		assert.Equal(spans[0].Tag(ext.TargetHost), parent.Tag(ext.TargetHost))
+		assert.Equal("scan_key:*", parent.Tag("redis.scan.pattern"))
+		assert.Equal(int64(2), parent.Tag("redis.scan.count"))
+		assert.Equal(len(spans)-1, parent.Tag("redis.scan.pages"))
+		assert.Equal(5, parent.Tag("redis.scan.keys"))
+		for _, page := range spans[:len(spans)-1] {
+			assert.Equal("redis.command", page.OperationName())
+			assert.Equal(parent.SpanID(), page.ParentID())
+		}
+	})
+
+	t.Run("pairs", func(t *testing.T) {
+		// relies on the deterministic pages of redistest.Server
+		requireTestServer(t)
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		client := NewClient(opts, WithServiceName("my-redis"))
+		client.Del(ctx, "scan_hash")
+		client.HSet(ctx, "scan_hash", "a", "1", "b", "2", "c", "3")
+		mt.Reset()
+
+		var elems []string
+		iter := HScan(ctx, client, "scan_hash", 0, "", 2)
+		for iter.Next(ctx) {
+			elems = append(elems, iter.Val())
+		}
+		assert.Nil(iter.Err())
+		assert.Equal([]string{"a", "1", "b", "2", "c", "3"}, elems)
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 3)
+		parent := spans[2]
+		assert.Equal("hscan", parent.Tag(ext.ResourceName))
+		assert.Equal(2, parent.Tag("redis.scan.pages"))
+		assert.Equal(3, parent.Tag("redis.scan.keys"))
+		assert.Equal(parent.SpanID(), spans[0].ParentID())
+		assert.Equal(parent.SpanID(), spans[1].ParentID())
+	})
+
+	t.Run("close", func(t *testing.T) {
+		// relies on the deterministic pages of redistest.Server
+		requireTestServer(t)
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		client := NewClient(opts, WithServiceName("my-redis"))
+		client.Del(ctx, "scan_set")
+		client.SAdd(ctx, "scan_set", "a", "b", "c")
+		mt.Reset()
+
+		iter := SScan(ctx, client, "scan_set", 0, "", 2)
+		assert.True(iter.Next(ctx))
+		assert.Equal("a", iter.Val())
+		iter.Close()
+		iter.Close()
+		assert.False(iter.Next(ctx))
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 2)
+		assert.Equal("sscan", spans[1].Tag(ext.ResourceName))
+		assert.Equal(1, spans[1].Tag("redis.scan.pages"))
+		assert.Equal(2, spans[1].Tag("redis.scan.keys"))
+	})
+
+	t.Run("error", func(t *testing.T) {
+		assert := assert.New(t)
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		client := NewClient(opts, WithServiceName("my-redis"))
+		client.Set(ctx, "scan_string", "value", 0)
+		mt.Reset()
+
+		iter := ZScan(ctx, client, "scan_string", 0, "", 0)
+		assert.False(iter.Next(ctx))
+		assert.NotNil(iter.Err())
+
+		spans := mt.FinishedSpans()
+		assert.Len(spans, 2)
+		assert.Equal(iter.Err(), spans[1].Tag(ext.Error))
+		assert.Equal(0, spans[1].Tag("redis.scan.pages"))
+	})
+}
@@ -0,0 +1,145 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redis
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// Script is a named Lua script whose executions are traced.
+type Script struct {
+	name   string
+	script *redis.Script
+	opts   []ClientOption
+	cfg    *clientConfig
+}
+
+// NewScript returns a new Script with the given name and source. The options
+// configure the parent span created by Run and should usually match the ones
+// used for the client. When Run is given a *redis.Client, its options are
+// applied first, as for WrapClient.
+func NewScript(name, src string, opts ...ClientOption) *Script {
+	return &Script{
+		name:   name,
+		script: redis.NewScript(src),
+		opts:   opts,
+		cfg:    newClientConfig(opts...),
+	}
+}
+
+// Name returns the name of the script.
+func (s *Script) Name() string {
+	return s.name
+}
+
+// Hash returns the SHA1 of the script source.
+func (s *Script) Hash() string {
+	return s.script.Hash()
+}
+
+// Script returns the underlying redis.Script.
+func (s *Script) Script() *redis.Script {
+	return s.script
+}
+
+// Run optimistically uses EVALSHA to run the script and retries using EVAL if
+// the script does not exist, like redis.Script.Run. Both attempts are traced
+// as children of a single "redis.script" span.
+func (s *Script) Run(ctx context.Context, c redis.Scripter, keys []string, args ...interface{}) *redis.Cmd {
+	if skipTracing(ctx) {
+		return s.script.Run(ctx, c, keys, args...)
+	}
+	cfg := s.cfg
+	if _, ok := c.(*redis.Client); ok {
+		cfg = newHelperConfig(c, s.opts)
+	}
+	opts := cfg.helperSpanOptions(ext.SpanTypeRedis, "client", s.name)
+	opts = append(opts,
+		tracer.Tag("redis.script.name", s.name),
+		tracer.Tag("redis.script.sha", s.Hash()),
+	)
+	span, ctx := tracer.StartSpanFromContext(ctx, "redis.script", opts...)
+
+	info := &scriptInfo{name: s.name}
+	r := s.script.EvalSha(contextWithScript(ctx, info), c, keys, args...)
+	fallback := isNoScript(r.Err())
+	if fallback {
+		info := &scriptInfo{name: s.name, fallback: true}
+		r = s.script.Eval(contextWithScript(ctx, info), c, keys, args...)
+	}
+	span.SetTag("redis.script.fallback", fallback)
+
+	var finishOpts []ddtrace.FinishOption
+	if err := r.Err(); err != nil && err != redis.Nil {
+		finishOpts = append(finishOpts, tracer.WithError(err))
+	}
+	span.Finish(finishOpts...)
+	return r
+}
+
+// scriptInfo describes a script execution started by Script.Run.
+type scriptInfo struct {
+	name     string
+	fallback bool
+}
+
+type scriptContextKey struct{}
+
+func contextWithScript(ctx context.Context, info *scriptInfo) context.Context {
+	return context.WithValue(ctx, scriptContextKey{}, info)
+}
+
+func scriptFromContext(ctx context.Context) (*scriptInfo, bool) {
+	info, ok := ctx.Value(scriptContextKey{}).(*scriptInfo)
+	return info, ok
+}
+
+// isNoScript reports whether err is the NOSCRIPT error returned by EVALSHA for
+// an unknown script.
+func isNoScript(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT ")
+}
+
+// isExpectedNoScript reports whether err is the NOSCRIPT error of an EVALSHA
+// run by Script.Run, which then falls back to EVAL.
+func isExpectedNoScript(ctx context.Context, err error) bool {
+	_, ok := scriptFromContext(ctx)
+	return ok && isNoScript(err)
+}
+
+// setScriptTags sets the script tags of an EVAL or EVALSHA command on span.
+func (cfg *clientConfig) setScriptTags(ctx context.Context, span ddtrace.Span, cmd redis.Cmder) {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return
+	}
+	var sha string
+	switch cmd.Name() {
+	case "evalsha":
+		sha = fmt.Sprint(args[1])
+	case "eval":
+		sum := sha1.Sum([]byte(fmt.Sprint(args[1])))
+		sha = hex.EncodeToString(sum[:])
+	default:
+		return
+	}
+	span.SetTag("redis.script.sha", sha)
+	if info, ok := scriptFromContext(ctx); ok {
+		span.SetTag("redis.script.name", info.name)
+		span.SetTag("redis.script.fallback", info.fallback)
+	} else if name, ok := cfg.scripts[sha]; ok {
+		span.SetTag("redis.script.name", name)
+	}
+}
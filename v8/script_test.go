@@ -0,0 +1,91 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+)
+
+func TestScript(t *testing.T) {
+	ctx := context.Background()
+	opts := &redis.Options{Addr: testServer.Addr()}
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	client := NewClient(opts, WithServiceName("my-redis"))
+	client.ScriptFlush(ctx)
+	script := NewScript("echo", "return ARGV[1]", WithServiceName("my-redis"))
+	mt.Reset()
+
+	res, err := script.Run(ctx, client, nil, "hello").Result()
+	assert.Nil(err)
+	assert.Equal("hello", res)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 3)
+	evalsha, eval, parent := spans[0], spans[1], spans[2]
+
+	assert.Equal("redis.script", parent.OperationName())
+	assert.Equal("echo", parent.Tag(ext.ResourceName))
+	assert.Equal("my-redis", parent.Tag(ext.ServiceName))
+	assert.Equal(script.Hash(), parent.Tag("redis.script.sha"))
+	assert.Equal(true, parent.Tag("redis.script.fallback"))
+	assert.Equal(componentName, parent.Tag("component"))
+	assert.Equal(evalsha.Tag(ext.TargetHost), parent.Tag(ext.TargetHost))
+
+	assert.Equal("evalsha", evalsha.Tag(ext.ResourceName))
+	assert.Equal(parent.SpanID(), evalsha.ParentID())
+	assert.Equal("echo", evalsha.Tag("redis.script.name"))
+	assert.Equal(script.Hash(), evalsha.Tag("redis.script.sha"))
+	assert.Equal(false, evalsha.Tag("redis.script.fallback"))
+	assert.Nil(evalsha.Tag(ext.Error))
+
+	assert.Equal("eval", eval.Tag(ext.ResourceName))
+	assert.Equal(parent.SpanID(), eval.ParentID())
+	assert.Equal("echo", eval.Tag("redis.script.name"))
+	assert.Equal(script.Hash(), eval.Tag("redis.script.sha"))
+	assert.Equal(true, eval.Tag("redis.script.fallback"))
+
+	script.Script().Load(ctx, client)
+	mt.Reset()
+	_, err = script.Run(ctx, client, nil, "hello").Result()
+	assert.Nil(err)
+
+	spans = mt.FinishedSpans()
+	assert.Len(spans, 2)
+	assert.Equal("evalsha", spans[0].Tag(ext.ResourceName))
+	assert.Equal(false, spans[1].Tag("redis.script.fallback"))
+}
+
+func TestWithScript(t *testing.T) {
+	ctx := context.Background()
+	opts := &redis.Options{Addr: testServer.Addr()}
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	script := redis.NewScript("return ARGV[1]")
+	client := NewClient(opts, WithServiceName("my-redis"), WithScript("echo", script))
+	script.Load(ctx, client)
+	mt.Reset()
+
+	client.EvalSha(ctx, script.Hash(), nil, "hello")
+	client.Eval(ctx, "return 1", nil)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 2)
+	assert.Equal("echo", spans[0].Tag("redis.script.name"))
+	assert.Equal(script.Hash(), spans[0].Tag("redis.script.sha"))
+	assert.Nil(spans[1].Tag("redis.script.name"))
+	assert.NotNil(spans[1].Tag("redis.script.sha"))
+}
@@ -0,0 +1,141 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redis
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// A ValuesCarrier injects and extracts traces from the values of a stream message.
+type ValuesCarrier map[string]interface{}
+
+var _ interface {
+	tracer.TextMapReader
+	tracer.TextMapWriter
+} = (ValuesCarrier)(nil)
+
+// ForeachKey iterates over every string value.
+func (c ValuesCarrier) ForeachKey(handler func(key, val string) error) error {
+	for k, v := range c {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if err := handler(k, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Set sets a value.
+func (c ValuesCarrier) Set(key, val string) {
+	c[key] = val
+}
+
+// XAdd appends a message to a stream like redis.Cmdable.XAdd, within a
+// "redis.stream.produce" span. The span context is added to the message
+// values, which may be a map or a slice as accepted by go-redis, so that
+// consumers can continue the trace with StartConsumeSpan. a.Values is not
+// modified.
+func XAdd(ctx context.Context, c redis.Cmdable, a *redis.XAddArgs, opts ...ClientOption) *redis.StringCmd {
+	if skipTracing(ctx) {
+		return c.XAdd(ctx, a)
+	}
+	cfg := newHelperConfig(c, opts)
+	spanOpts := cfg.helperSpanOptions(ext.SpanTypeMessageProducer, "producer", a.Stream)
+	spanOpts = append(spanOpts, tracer.Tag("redis.stream", a.Stream))
+	span, ctx := tracer.StartSpanFromContext(ctx, "redis.stream.produce", spanOpts...)
+
+	carrier := make(ValuesCarrier)
+	if err := tracer.Inject(span.Context(), carrier); err == nil {
+		args := *a
+		args.Values = valuesWithCarrier(a.Values, carrier)
+		a = &args
+	}
+	cmd := c.XAdd(ctx, a)
+	var finishOpts []ddtrace.FinishOption
+	if err := cmd.Err(); err != nil && err != redis.Nil {
+		finishOpts = append(finishOpts, tracer.WithError(err))
+	}
+	if id := cmd.Val(); id != "" {
+		span.SetTag("redis.stream.message_id", id)
+	}
+	span.Finish(finishOpts...)
+	return cmd
+}
+
+// valuesWithCarrier returns a copy of values, in any of the forms accepted
+// by XAddArgs.Values, with the entries of carrier added.
+func valuesWithCarrier(values interface{}, carrier ValuesCarrier) interface{} {
+	switch values := values.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(values)+len(carrier))
+		for k, v := range values {
+			m[k] = v
+		}
+		for k, v := range carrier {
+			m[k] = v
+		}
+		return m
+	case map[string]string:
+		m := make(map[string]string, len(values)+len(carrier))
+		for k, v := range values {
+			m[k] = v
+		}
+		for k, v := range carrier {
+			m[k] = v.(string)
+		}
+		return m
+	case []string:
+		s := make([]string, 0, len(values)+2*len(carrier))
+		s = append(s, values...)
+		for k, v := range carrier {
+			s = append(s, k, v.(string))
+		}
+		return s
+	case []interface{}:
+		s := make([]interface{}, 0, len(values)+2*len(carrier))
+		s = append(s, values...)
+		for k, v := range carrier {
+			s = append(s, k, v)
+		}
+		return s
+	default:
+		return values
+	}
+}
+
+// StartConsumeSpan starts a "redis.stream.consume" span for a message read
+// from stream with XREAD or XREADGROUP. If the message was added with XAdd,
+// the span is a child of the producer span, otherwise of the span in ctx.
+// The caller is responsible for finishing the span, which does nothing if
+// tracing is skipped for ctx.
+func StartConsumeSpan(ctx context.Context, stream string, msg redis.XMessage, opts ...ClientOption) (ddtrace.Span, context.Context) {
+	if skipTracing(ctx) {
+		return noopSpan{}, ctx
+	}
+	cfg := newClientConfig(opts...)
+	spanOpts := cfg.helperSpanOptions(ext.SpanTypeMessageConsumer, "consumer", stream)
+	spanOpts = append(spanOpts,
+		tracer.Tag("redis.stream", stream),
+		tracer.Tag("redis.stream.message_id", msg.ID),
+	)
+	spanctx, err := tracer.Extract(ValuesCarrier(msg.Values))
+	if err != nil {
+		return tracer.StartSpanFromContext(ctx, "redis.stream.consume", spanOpts...)
+	}
+	// the producer span takes precedence over the span of ctx, which
+	// StartSpanFromContext would make the parent
+	spanOpts = append(spanOpts, tracer.ChildOf(spanctx))
+	span := tracer.StartSpan("redis.stream.consume", spanOpts...)
+	return span, tracer.ContextWithSpan(ctx, span)
+}
@@ -0,0 +1,103 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016-2020 Datadog, Inc.
+
+package redis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+func TestStream(t *testing.T) {
+	ctx := context.Background()
+	opts := &redis.Options{Addr: testServer.Addr()}
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	client := NewClient(opts, WithServiceName("my-redis"))
+	client.Del(ctx, "test_stream")
+	mt.Reset()
+
+	values := map[string]interface{}{"job": "resize"}
+	id, err := XAdd(ctx, client, &redis.XAddArgs{Stream: "test_stream", Values: values}, WithServiceName("producer")).Result()
+	assert.Nil(err)
+	assert.Len(values, 1)
+
+	streams, err := client.XRead(ctx, &redis.XReadArgs{Streams: []string{"test_stream", "0"}}).Result()
+	assert.Nil(err)
+	assert.Len(streams, 1)
+	assert.Len(streams[0].Messages, 1)
+	msg := streams[0].Messages[0]
+	assert.Equal("resize", msg.Values["job"])
+
+	// the producer span takes precedence over the span of the consumer
+	worker, workerCtx := tracer.StartSpanFromContext(ctx, "worker")
+	span, spanCtx := StartConsumeSpan(workerCtx, "test_stream", msg, WithServiceName("consumer"))
+	current, _ := tracer.SpanFromContext(spanCtx)
+	assert.Equal(span, current)
+	span.Finish()
+	worker.Finish()
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 5)
+	xadd, produce, consume := spans[0], spans[1], spans[3]
+
+	assert.Equal("redis.stream.produce", produce.OperationName())
+	assert.Equal(ext.SpanTypeMessageProducer, produce.Tag(ext.SpanType))
+	assert.Equal("producer", produce.Tag(ext.ServiceName))
+	assert.Equal("test_stream", produce.Tag(ext.ResourceName))
+	assert.Equal(id, produce.Tag("redis.stream.message_id"))
+	assert.Equal(produce.SpanID(), xadd.ParentID())
+	assert.Equal("producer", produce.Tag("span.kind"))
+	assert.Equal(xadd.Tag(ext.TargetHost), produce.Tag(ext.TargetHost))
+
+	assert.Equal("redis.stream.consume", consume.OperationName())
+	assert.Equal(ext.SpanTypeMessageConsumer, consume.Tag(ext.SpanType))
+	assert.Equal("consumer", consume.Tag(ext.ServiceName))
+	assert.Equal(id, consume.Tag("redis.stream.message_id"))
+	assert.Equal("consumer", consume.Tag("span.kind"))
+	assert.Equal(produce.SpanID(), consume.ParentID())
+	assert.Equal(produce.TraceID(), consume.TraceID())
+}
+
+func TestStreamNoMkStream(t *testing.T) {
+	ctx := context.Background()
+	opts := &redis.Options{Addr: testServer.Addr()}
+	assert := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	client := NewClient(opts)
+	client.Del(ctx, "test_missing_stream")
+	mt.Reset()
+
+	args := &redis.XAddArgs{Stream: "test_missing_stream", NoMkStream: true, Values: []string{"a", "1"}}
+	assert.Equal(redis.Nil, XAdd(ctx, client, args).Err())
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 2)
+	produce := spans[1]
+	assert.Equal("redis.stream.produce", produce.OperationName())
+	assert.Nil(produce.Tag(ext.Error))
+	assert.Nil(produce.Tag("redis.stream.message_id"))
+}
+
+func TestValuesWithCarrier(t *testing.T) {
+	assert := assert.New(t)
+	carrier := ValuesCarrier{"k": "v"}
+
+	assert.Equal(map[string]interface{}{"a": 1, "k": "v"}, valuesWithCarrier(map[string]interface{}{"a": 1}, carrier))
+	assert.Equal(map[string]string{"a": "1", "k": "v"}, valuesWithCarrier(map[string]string{"a": "1"}, carrier))
+	assert.Equal([]string{"a", "1", "k", "v"}, valuesWithCarrier([]string{"a", "1"}, carrier))
+	assert.Equal([]interface{}{"a", 1, "k", "v"}, valuesWithCarrier([]interface{}{"a", 1}, carrier))
+	assert.Equal("a", valuesWithCarrier("a", carrier))
+}